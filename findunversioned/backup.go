@@ -0,0 +1,502 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/uluyol/tools/findunversioned/unversioned"
+)
+
+const manifestName = ".findunversioned-manifest"
+
+func backupUsage(fset *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s backup (-dest dir | -tar file) [options] dir...\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Copies the files in unversioned directories into a mirror or an incremental tar.")
+		fmt.Fprintln(os.Stderr, "A manifest of content hashes is kept so that later runs only copy files that changed.")
+		fmt.Fprintln(os.Stderr)
+		fset.PrintDefaults()
+		os.Exit(1)
+	}
+}
+
+func backupMain(args []string) {
+	fset := flag.NewFlagSet("backup", flag.ExitOnError)
+	var (
+		opts     = newWalkFlags(fset)
+		dest     = fset.String("dest", "", "mirror unversioned directories into `dir`")
+		tarPath  = fset.String("tar", "", "write files that changed since the last backup to the tar `file`")
+		manPath  = fset.String("manifest", "", "manifest `file` (default "+manifestName+" in the destination directory)")
+		dryRun   = fset.Bool("n", false, "print what would be copied, but don't copy anything")
+		doDelete = fset.Bool("delete", false, "remove backed-up files that no longer exist under the given dirs (with -tar, just forget them)")
+	)
+	fset.Usage = backupUsage(fset)
+	fset.Parse(args)
+	if fset.NArg() == 0 || (*dest == "") == (*tarPath == "") {
+		fset.Usage()
+	}
+	if *manPath == "" {
+		if *dest != "" {
+			*manPath = filepath.Join(*dest, manifestName)
+		} else {
+			*manPath = filepath.Join(filepath.Dir(*tarPath), manifestName)
+		}
+	}
+
+	res, ex, failed := opts.find(fset.Args())
+	man, err := readManifest(*manPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "findunversioned: %v\n", err)
+		os.Exit(1)
+	}
+
+	var s sink
+	switch {
+	case *dryRun:
+		s = &drySink{w: os.Stdout}
+	case *dest != "":
+		s = &mirrorSink{dir: *dest}
+	default:
+		s, err = newTarSink(*tarPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "findunversioned: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	b := &backup{
+		man:  man,
+		seen: make(map[string]bool),
+		sink: s,
+		ex:   ex,
+		skip: make(map[string]bool),
+	}
+	for _, p := range []string{*dest, *tarPath, *manPath} {
+		if p == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(p); err == nil {
+			b.skip[abs] = true
+		}
+	}
+	for _, r := range res {
+		for _, d := range r.Unversioned {
+			b.addTree(r.Root, d.Path)
+		}
+	}
+	failed = failed || b.failed
+	// After an error, files that weren't seen may still exist,
+	// so deleting them could destroy the only good copy.
+	if *doDelete && failed {
+		fmt.Fprintln(os.Stderr, "findunversioned: not removing anything because of errors")
+	} else if *doDelete {
+		var roots []string
+		for _, r := range res {
+			roots = append(roots, r.Root)
+		}
+		if err := b.removeGone(roots); err != nil {
+			fmt.Fprintf(os.Stderr, "findunversioned: %v\n", err)
+			failed = true
+		}
+	}
+	if err := s.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "findunversioned: %v\n", err)
+		os.Exit(1)
+	}
+	if !*dryRun {
+		if err := man.write(*manPath); err != nil {
+			fmt.Fprintf(os.Stderr, "findunversioned: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d files changed (%s), %d removed\n", b.ncopied, humanSize(b.bytes), b.nremoved)
+	exit(failed)
+}
+
+// A backup copies changed files to a sink and keeps the manifest up to date.
+type backup struct {
+	man  manifest
+	seen map[string]bool // sources present in this run
+	sink sink
+	ex   *unversioned.Excluder
+	skip map[string]bool // absolute paths of our own output
+
+	failed   bool // some file couldn't be backed up
+	ncopied  int
+	nremoved int
+	bytes    int64
+}
+
+// report prints an error and notes that the backup is incomplete.
+func (b *backup) report(err error) {
+	fmt.Fprintf(os.Stderr, "findunversioned: %v\n", err)
+	b.failed = true
+}
+
+// addTree adds the files in dir, which was found by walking root.
+// Errors are reported and the walk goes on.
+func (b *backup) addTree(root, dir string) {
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			b.report(err)
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			b.report(err)
+			return nil
+		}
+		if b.skip[abs] {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if rel, err := filepath.Rel(root, p); err == nil && rel != "." && b.ex.Match(filepath.ToSlash(rel), abs) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() && d.Type()&fs.ModeSymlink == 0 {
+			return nil // devices, sockets and the like can't be backed up
+		}
+		info, err := d.Info()
+		if err == nil {
+			err = b.addFile(&backupFile{Src: abs, Info: info})
+		}
+		if err != nil {
+			b.report(err)
+		}
+		return nil
+	})
+}
+
+func (b *backup) addFile(f *backupFile) error {
+	b.seen[f.Src] = true
+	ent := manifestEntry{Size: f.Info.Size(), ModTime: f.Info.ModTime().UnixNano()}
+	old, ok := b.man[f.Src]
+	if ok && old.Size == ent.Size && old.ModTime == ent.ModTime {
+		return nil
+	}
+	if f.Info.Mode()&fs.ModeSymlink != 0 {
+		link, err := os.Readlink(f.Src)
+		if err != nil {
+			return err
+		}
+		f.Link = link
+	}
+	var err error
+	ent.Hash, err = f.hash()
+	if err != nil {
+		return err
+	}
+	if !ok || old.Hash != ent.Hash {
+		if err := b.sink.Add(f); err != nil {
+			return err
+		}
+		b.ncopied++
+		b.bytes += ent.Size
+	}
+	b.man[f.Src] = ent
+	return nil
+}
+
+// removeGone removes files from the sink and manifest whose source was
+// under one of roots but no longer exists. Files outside the roots, and
+// ones that still exist but weren't backed up this time because they
+// are now excluded or versioned, are kept.
+func (b *backup) removeGone(roots []string) error {
+	var abs []string
+	for _, r := range roots {
+		a, err := filepath.Abs(r)
+		if err != nil {
+			return err
+		}
+		abs = append(abs, a)
+	}
+	var gone []string
+	for src := range b.man {
+		if b.seen[src] || !under(abs, src) {
+			continue
+		}
+		if _, err := os.Lstat(src); os.IsNotExist(err) {
+			gone = append(gone, src)
+		} else if err != nil {
+			return err
+		}
+	}
+	sort.Strings(gone)
+	for _, src := range gone {
+		if err := b.sink.Remove(src); err != nil {
+			return err
+		}
+		delete(b.man, src)
+		b.nremoved++
+	}
+	return nil
+}
+
+// under reports whether p is in or below any of dirs.
+func under(dirs []string, p string) bool {
+	for _, d := range dirs {
+		rel, err := filepath.Rel(d, p)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// A backupFile is a regular file or symbolic link to be backed up.
+type backupFile struct {
+	Src  string // absolute path
+	Info fs.FileInfo
+	Link string // target, if a symbolic link
+}
+
+func (f *backupFile) hash() (string, error) {
+	h := sha256.New()
+	if f.Info.Mode()&fs.ModeSymlink != 0 {
+		io.WriteString(h, "link:"+f.Link)
+	} else {
+		r, err := os.Open(f.Src)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, r)
+		r.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// archiveName returns the name src is stored under in a mirror or archive:
+// its absolute path with the volume and leading separators removed.
+func archiveName(src string) string {
+	src = strings.TrimPrefix(src, filepath.VolumeName(src))
+	return strings.TrimLeft(filepath.ToSlash(src), "/")
+}
+
+// A sink receives the files that changed since the last backup.
+type sink interface {
+	Add(f *backupFile) error
+	Remove(src string) error
+	Close() error
+}
+
+// drySink prints what would be done.
+type drySink struct {
+	w io.Writer
+}
+
+func (s *drySink) Add(f *backupFile) error {
+	_, err := fmt.Fprintf(s.w, "copy\t%s\t%s\n", humanSize(f.Info.Size()), f.Src)
+	return err
+}
+
+func (s *drySink) Remove(src string) error {
+	_, err := fmt.Fprintf(s.w, "delete\t\t%s\n", src)
+	return err
+}
+
+func (s *drySink) Close() error { return nil }
+
+// mirrorSink copies files into a directory tree.
+type mirrorSink struct {
+	dir string
+}
+
+func (s *mirrorSink) Add(f *backupFile) error {
+	dst := filepath.Join(s.dir, filepath.FromSlash(archiveName(f.Src)))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if f.Link != "" {
+		if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return os.Symlink(f.Link, dst)
+	}
+	r, err := os.Open(f.Src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.CreateTemp(filepath.Dir(dst), ".findunversioned-")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	if err == nil {
+		err = w.Chmod(f.Info.Mode().Perm())
+	}
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chtimes(w.Name(), f.Info.ModTime(), f.Info.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(w.Name(), dst)
+	}
+	if err != nil {
+		os.Remove(w.Name())
+	}
+	return err
+}
+
+func (s *mirrorSink) Remove(src string) error {
+	err := os.Remove(filepath.Join(s.dir, filepath.FromSlash(archiveName(src))))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *mirrorSink) Close() error { return nil }
+
+// tarSink writes files to a tar archive. Removals can't be recorded in a
+// tar, so they are dropped.
+type tarSink struct {
+	f  *os.File
+	bw *bufio.Writer
+	tw *tar.Writer
+}
+
+func newTarSink(p string) (*tarSink, error) {
+	f, err := os.Create(p)
+	if err != nil {
+		return nil, err
+	}
+	bw := bufio.NewWriter(f)
+	return &tarSink{f: f, bw: bw, tw: tar.NewWriter(bw)}, nil
+}
+
+func (s *tarSink) Add(f *backupFile) error {
+	hdr, err := tar.FileInfoHeader(f.Info, f.Link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = archiveName(f.Src)
+	if err := s.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if f.Link != "" {
+		return nil
+	}
+	r, err := os.Open(f.Src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if _, err := io.CopyN(s.tw, r, hdr.Size); err != nil {
+		return fmt.Errorf("%s: %v (changed during backup?)", f.Src, err)
+	}
+	return nil
+}
+
+func (s *tarSink) Remove(src string) error { return nil }
+
+func (s *tarSink) Close() error {
+	err := s.tw.Close()
+	if err == nil {
+		err = s.bw.Flush()
+	}
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// A manifest records the files saved by earlier backups,
+// keyed by absolute source path.
+type manifest map[string]manifestEntry
+
+type manifestEntry struct {
+	Hash    string // hex SHA-256 of the content, or of the link target
+	Size    int64
+	ModTime int64 // Unix nanoseconds
+}
+
+// readManifest reads the manifest at p. A missing manifest is empty.
+// Each line holds a hash, size, modification time and quoted path.
+func readManifest(p string) (manifest, error) {
+	m := make(manifest)
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for lineno := 1; s.Scan(); lineno++ {
+		fs := strings.SplitN(s.Text(), "\t", 4)
+		if len(fs) != 4 {
+			return nil, fmt.Errorf("%s:%d: malformed entry", p, lineno)
+		}
+		var (
+			ent  = manifestEntry{Hash: fs[0]}
+			perr error
+		)
+		ent.Size, perr = strconv.ParseInt(fs[1], 10, 64)
+		if perr == nil {
+			ent.ModTime, perr = strconv.ParseInt(fs[2], 10, 64)
+		}
+		src, err := strconv.Unquote(fs[3])
+		if perr != nil || err != nil {
+			return nil, fmt.Errorf("%s:%d: malformed entry", p, lineno)
+		}
+		m[src] = ent
+	}
+	return m, s.Err()
+}
+
+// write atomically replaces the manifest at p.
+func (m manifest) write(p string) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	srcs := make([]string, 0, len(m))
+	for src := range m {
+		srcs = append(srcs, src)
+	}
+	sort.Strings(srcs)
+	f, err := os.CreateTemp(filepath.Dir(p), ".findunversioned-")
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	for _, src := range srcs {
+		ent := m[src]
+		fmt.Fprintf(bw, "%s\t%d\t%d\t%q\n", ent.Hash, ent.Size, ent.ModTime, src)
+	}
+	err = bw.Flush()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
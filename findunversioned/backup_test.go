@@ -0,0 +1,152 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/uluyol/tools/findunversioned/unversioned"
+)
+
+// recordSink records the files added and removed.
+type recordSink struct {
+	added, removed []string
+}
+
+func (s *recordSink) Add(f *backupFile) error {
+	s.added = append(s.added, f.Src)
+	return nil
+}
+
+func (s *recordSink) Remove(src string) error {
+	s.removed = append(s.removed, src)
+	return nil
+}
+
+func (s *recordSink) Close() error { return nil }
+
+func newTestBackup(man manifest) (*backup, *recordSink) {
+	s := new(recordSink)
+	return &backup{
+		man:  man,
+		seen: make(map[string]bool),
+		sink: s,
+		ex:   new(unversioned.Excluder),
+		skip: make(map[string]bool),
+	}, s
+}
+
+func writeFile(t *testing.T, p, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "sub", manifestName)
+	want := manifest{
+		"/home/u/notes/a":          {Hash: "00ff", Size: 3, ModTime: 1600000000123456789},
+		"/home/u/odd\tname\n\"x\"": {Hash: "abcd", Size: 0, ModTime: -1},
+	}
+	if err := want.write(p); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readManifest(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if m, err := readManifest(filepath.Join(t.TempDir(), "missing")); err != nil || len(m) != 0 {
+		t.Errorf("missing manifest: got %v, %v, want an empty one", m, err)
+	}
+	writeFile(t, p, "not a manifest\n")
+	if _, err := readManifest(p); err == nil {
+		t.Error("malformed manifest was read without error")
+	}
+}
+
+func TestBackupSkipsUnchanged(t *testing.T) {
+	root := t.TempDir()
+	a, b := filepath.Join(root, "a"), filepath.Join(root, "d", "b")
+	writeFile(t, a, "aaa")
+	writeFile(t, b, "bbb")
+
+	man := make(manifest)
+	run := func() []string {
+		bk, s := newTestBackup(man)
+		bk.addTree(root, root)
+		if bk.failed {
+			t.Fatal("backup failed")
+		}
+		sort.Strings(s.added)
+		return s.added
+	}
+	if got, want := run(), []string{a, b}; !reflect.DeepEqual(got, want) {
+		t.Errorf("first run copied %q, want %q", got, want)
+	}
+	if got := run(); len(got) != 0 {
+		t.Errorf("unchanged files were copied again: %q", got)
+	}
+
+	// A new modification time alone is caught by the hash.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(a, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got := run(); len(got) != 0 {
+		t.Errorf("touched file was copied again: %q", got)
+	}
+	if man[a].ModTime != later.UnixNano() {
+		t.Errorf("manifest has mtime %d, want %d", man[a].ModTime, later.UnixNano())
+	}
+
+	writeFile(t, b, "changed")
+	if got, want := run(), []string{b}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after a change copied %q, want %q", got, want)
+	}
+}
+
+func TestBackupDeleteScope(t *testing.T) {
+	dir := t.TempDir()
+	rootA, rootB := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	var (
+		kept     = filepath.Join(rootA, "kept")
+		excluded = filepath.Join(rootA, "excluded", "x")
+		goneA    = filepath.Join(rootA, "gone")
+		goneB    = filepath.Join(rootB, "gone")
+		prefix   = filepath.Join(dir, "ab", "gone") // not under a, despite the name
+	)
+	writeFile(t, kept, "k")
+	writeFile(t, excluded, "x")
+
+	man := make(manifest)
+	for _, src := range []string{kept, excluded, goneA, goneB, prefix} {
+		man[src] = manifestEntry{Hash: "00", Size: 1}
+	}
+	bk, s := newTestBackup(man)
+	bk.seen[kept] = true
+	if err := bk.removeGone([]string{rootA}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{goneA}; !reflect.DeepEqual(s.removed, want) {
+		t.Errorf("removed %q, want %q", s.removed, want)
+	}
+	for _, src := range []string{kept, excluded, goneB, prefix} {
+		if _, ok := man[src]; !ok {
+			t.Errorf("%s was dropped from the manifest", src)
+		}
+	}
+	if _, ok := man[goneA]; ok {
+		t.Errorf("%s is still in the manifest", goneA)
+	}
+}
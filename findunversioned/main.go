@@ -1,84 +1,251 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+
+	"github.com/uluyol/tools/findunversioned/unversioned"
+)
+
+var (
+	showStatus  = flag.Bool("status", false, "report untracked files, uncommitted changes and unpushed commits inside repositories")
+	showIgnored = flag.Bool("ignored", false, "with -status, also report files ignored by the VCS")
+	sortKey     = flag.String("sort", "", "sort directories by `key`: path, size, files or mtime")
+	format      = flag.String("format", "plain", "output `format`: plain, long, tsv or json (not tsv with -status)")
+	walkOpts    = newWalkFlags(flag.CommandLine)
 )
 
-var isVCS = map[string]bool{
-	".git": true,
-	".hg":  true,
-	".bzr": true,
-	".svn": true,
+// walkFlags holds the flags that control how directories are found.
+// They are shared by all subcommands.
+type walkFlags struct {
+	workers     *int
+	follow      *bool
+	excludeFrom *string
+	useSync     *bool
+	rulesFile   *string
+	excludes    stringsFlag
+	markers     stringsFlag
 }
 
-func containsVCS(names []string) bool {
-	for _, n := range names {
-		if isVCS[n] {
-			return true
-		}
+func newWalkFlags(fset *flag.FlagSet) *walkFlags {
+	f := &walkFlags{
+		workers:     fset.Int("j", runtime.NumCPU(), "number of directories to read concurrently"),
+		follow:      fset.Bool("L", false, "follow symbolic links to directories"),
+		excludeFrom: fset.String("exclude-from", defaultExcludeFile(), "file of exclude patterns, one per line"),
+		useSync:     fset.Bool("sync", false, "treat directories synced by tools like Syncthing as versioned"),
+		rulesFile:   fset.String("rules", defaultRulesFile(), "file of extra detection rules: name marker [dir|file]"),
 	}
-	return false
+	fset.Var(&f.excludes, "exclude", "skip directories matching the gitignore-style `pattern` (may be repeated)")
+	fset.Var(&f.markers, "marker", "treat directories containing a file or directory `name` as versioned (may be repeated)")
+	return f
+}
+
+type stringsFlag []string
+
+func (f *stringsFlag) String() string     { return strings.Join(*f, ",") }
+func (f *stringsFlag) Set(s string) error { *f = append(*f, s); return nil }
+
+func defaultExcludeFile() string {
+	return filepath.Join(xdgConfigDir(), "findunversioned", "exclude")
 }
 
-func walk(dir string) ([]string, error) {
-	var nover []string
-	fi, err := os.Stat(dir)
-	if err != nil || !fi.IsDir() {
-		return nover, err // err will be nil if fi is not a directory
+func defaultRulesFile() string {
+	return filepath.Join(xdgConfigDir(), "findunversioned", "rules")
+}
+
+func xdgConfigDir() string {
+	if d := os.Getenv("XDG_CONFIG_HOME"); d != "" {
+		return d
 	}
-	d, err := os.Open(dir)
+	// The same home that ~/ in exclude patterns stands for.
+	return filepath.Join(unversioned.HomeDir(), ".config")
+}
+
+// osFS is a file system rooted at an operating system directory.
+type osFS struct {
+	fs.FS
+	dir string
+}
+
+func newOSFS(dir string) osFS {
+	return osFS{os.DirFS(dir), dir}
+}
+
+func (f osFS) RealPath(name string) (string, error) {
+	abs, err := filepath.Abs(f.path(name))
 	if err != nil {
-		return nover, err
+		return "", err
 	}
-	subfi, err := d.Readdir(-1)
-	d.Close()
+	return filepath.EvalSymlinks(abs)
+}
+
+// path converts a path in f to one the operating system understands.
+func (f osFS) path(name string) string {
+	return filepath.Join(f.dir, filepath.FromSlash(name))
+}
+
+// A found holds the results of walking one root.
+type found struct {
+	Root        string // as given on the command line
+	Unversioned []unversioned.Dir
+	Repos       []unversioned.Repo
+}
+
+// find walks the roots. Errors are printed as they're found;
+// failed reports whether there were any.
+func (f *walkFlags) find(roots []string) (res []found, ex *unversioned.Excluder, failed bool) {
+	ex = new(unversioned.Excluder)
+	err := readConfig(*f.excludeFrom, defaultExcludeFile(), func(r *os.File) error {
+		return ex.AddFrom(r)
+	})
 	if err != nil {
-		return nover, err
-	}
-	var names []string
-	for i := 0; i < len(subfi); {
-		if !subfi[i].IsDir() {
-			if i < len(subfi)-1 {
-				subfi[i] = subfi[len(subfi)-1]
-			}
-			subfi = subfi[:len(subfi)-1]
-			continue
-		}
-		names = append(names, subfi[i].Name())
-		i++
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, p := range f.excludes {
+		ex.Add(p)
+	}
+
+	rules := append([]unversioned.Rule(nil), unversioned.DefaultRules...)
+	if *f.useSync {
+		rules = append(rules, unversioned.SyncRules...)
+	}
+	err = readConfig(*f.rulesFile, defaultRulesFile(), func(r *os.File) error {
+		extra, err := unversioned.ReadRules(r)
+		rules = append(rules, extra...)
+		return err
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	if containsVCS(names) {
-		return nover, nil
+	for _, m := range f.markers {
+		rules = append(rules, unversioned.Rule{Name: m, Marker: m})
 	}
-	for _, n := range names {
-		if nv, err := walk(filepath.Join(dir, n)); err != nil {
-			return nover, err
-		} else {
-			nover = append(nover, nv...)
+
+	var fsys osFS
+	report := func(err error) {
+		if pe, ok := err.(*fs.PathError); ok {
+			pe.Path = fsys.path(pe.Path)
 		}
+		fmt.Fprintf(os.Stderr, "findunversioned: %v\n", err)
+		failed = true
+	}
+	finder := &unversioned.Finder{
+		Rules:       rules,
+		Exclude:     ex,
+		Workers:     *f.workers,
+		FollowLinks: *f.follow,
+		OnError:     report,
 	}
-	if len(nover) == len(names) {
-		return []string{dir}, nil
+	for _, d := range roots {
+		fsys = newOSFS(d)
+		r, err := finder.Find(fsys, ".")
+		if err != nil {
+			report(err)
+			continue
+		}
+		fd := found{Root: d}
+		for _, u := range r.Unversioned {
+			u.Path = fsys.path(u.Path)
+			fd.Unversioned = append(fd.Unversioned, u)
+		}
+		for _, r := range r.Repos {
+			r.Dir = fsys.path(r.Dir)
+			fd.Repos = append(fd.Repos, r)
+		}
+		res = append(res, fd)
 	}
-	return nover, nil
+	return res, ex, failed
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [options] [dir1] [dir2] [...]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s backup [options] dir...\n", os.Args[0])
+	flag.PrintDefaults()
+	os.Exit(1)
 }
 
 func main() {
-	if len(os.Args) <= 1 {
-		fmt.Fprintf(os.Stderr, "Usage: %s [dir1] [dir2] [...]\n", os.Args[0])
+	if len(os.Args) > 1 && os.Args[1] == "backup" {
+		backupMain(os.Args[2:])
+		return
+	}
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+	}
+	res, _, failed := walkOpts.find(flag.Args())
+	var (
+		nover []unversioned.Dir
+		repos []unversioned.Repo
+	)
+	for _, r := range res {
+		nover = append(nover, r.Unversioned...)
+		repos = append(repos, r.Repos...)
+	}
+	if err := sortDirs(nover, *sortKey); err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	var nover []string
-	for _, d := range os.Args[1:] {
-		if nv, err := walk(d); err != nil {
+	if !*showStatus {
+		if err := printDirs(os.Stdout, nover, *format, ""); err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
-		} else {
-			nover = append(nover, nv...)
 		}
+		exit(failed)
+	}
+
+	if *format == "tsv" {
+		fmt.Fprintln(os.Stderr, "findunversioned: -status doesn't support tsv output")
+		os.Exit(1)
+	}
+	var statuses []*status
+	for _, r := range repos {
+		st, err := repoStatus(r, *showIgnored)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", r.Dir, err)
+			failed = true
+			continue
+		}
+		if st == nil || st.Clean() {
+			continue
+		}
+		statuses = append(statuses, st)
+	}
+	if err := printStatus(os.Stdout, nover, statuses, *format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	exit(failed)
+}
+
+func exit(failed bool) {
+	if failed {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// readConfig calls read with the file at p.
+// A missing file is not an error if p is the default.
+func readConfig(p, def string, read func(*os.File) error) error {
+	f, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) && p == def {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	if err := read(f); err != nil {
+		return fmt.Errorf("%s: %v", p, err)
 	}
-	fmt.Println(strings.Join(nover, "\n"))
+	return nil
 }
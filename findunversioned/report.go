@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/uluyol/tools/findunversioned/unversioned"
+)
+
+// sortDirs sorts dirs by key. Sizes, file counts and times are sorted
+// largest (or newest) first.
+func sortDirs(dirs []unversioned.Dir, key string) error {
+	var less func(a, b *unversioned.Dir) bool
+	switch key {
+	case "":
+		return nil
+	case "path":
+		less = func(a, b *unversioned.Dir) bool { return a.Path < b.Path }
+	case "size":
+		less = func(a, b *unversioned.Dir) bool { return a.Size > b.Size }
+	case "files":
+		less = func(a, b *unversioned.Dir) bool { return a.Files > b.Files }
+	case "mtime":
+		less = func(a, b *unversioned.Dir) bool { return a.ModTime.After(b.ModTime) }
+	default:
+		return fmt.Errorf("unknown sort key %q", key)
+	}
+	sort.SliceStable(dirs, func(i, j int) bool { return less(&dirs[i], &dirs[j]) })
+	return nil
+}
+
+// printDirs writes dirs to w in the given format, prefixing each text line with indent.
+func printDirs(w io.Writer, dirs []unversioned.Dir, format, indent string) error {
+	switch format {
+	case "plain":
+		for _, d := range dirs {
+			if _, err := fmt.Fprintln(w, indent+d.Path); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "long":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+		for _, d := range dirs {
+			fmt.Fprintf(tw, "%s%s\t%d\t%s\t %s\n", indent, humanSize(d.Size), d.Files,
+				d.ModTime.Format("2006-01-02 15:04"), d.Path)
+		}
+		return tw.Flush()
+	case "tsv":
+		fmt.Fprintln(w, "size\tfiles\tmtime\tpath")
+		for _, d := range dirs {
+			if _, err := fmt.Fprintf(w, "%d\t%d\t%s\t%s\n", d.Size, d.Files,
+				d.ModTime.Format(time.RFC3339), d.Path); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "json":
+		if dirs == nil {
+			dirs = []unversioned.Dir{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(dirs)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// printStatus writes the unversioned dirs and the statuses of repositories
+// that aren't clean to w in the given format, which can't be tsv.
+func printStatus(w io.Writer, dirs []unversioned.Dir, statuses []*status, format string) error {
+	if format == "json" {
+		v := struct {
+			Unversioned []unversioned.Dir `json:"unversioned"`
+			Repos       []*status         `json:"repos"`
+		}{dirs, statuses}
+		if v.Unversioned == nil {
+			v.Unversioned = []unversioned.Dir{}
+		}
+		if v.Repos == nil {
+			v.Repos = []*status{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(v)
+	}
+	if len(dirs) > 0 {
+		fmt.Fprintln(w, "unversioned directories:")
+		if err := printDirs(w, dirs, format, "\t"); err != nil {
+			return err
+		}
+	}
+	for _, st := range statuses {
+		if _, err := io.WriteString(w, st.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func humanSize(n int64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return strconv.FormatInt(n, 10) + "B"
+	}
+	v := float64(n)
+	i := -1
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	return strconv.FormatFloat(v, 'f', 1, 64) + units[i:i+1]
+}
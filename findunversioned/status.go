@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/uluyol/tools/findunversioned/unversioned"
+)
+
+// A status lists what would be lost if a repository's working copy
+// disappeared: files the VCS doesn't know about, changes that haven't
+// been committed and commits that haven't been pushed anywhere.
+type status struct {
+	Dir         string   `json:"dir"`
+	VCS         string   `json:"vcs"`
+	Untracked   []string `json:"untracked,omitempty"`
+	Ignored     []string `json:"ignored,omitempty"`
+	Uncommitted []string `json:"uncommitted,omitempty"`
+	Unpushed    []string `json:"unpushed,omitempty"`
+}
+
+func (s *status) Clean() bool {
+	return len(s.Untracked) == 0 && len(s.Ignored) == 0 &&
+		len(s.Uncommitted) == 0 && len(s.Unpushed) == 0
+}
+
+func (s *status) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s (%s):\n", s.Dir, s.VCS)
+	section := func(name string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Fprintf(&buf, "\t%s:\n", name)
+		for _, l := range lines {
+			fmt.Fprintf(&buf, "\t\t%s\n", l)
+		}
+	}
+	section("untracked", s.Untracked)
+	section("ignored", s.Ignored)
+	section("uncommitted", s.Uncommitted)
+	section("unpushed", s.Unpushed)
+	return buf.String()
+}
+
+// repoStatus asks the VCS that manages r for its status.
+// It returns a nil status if the VCS isn't one we know how to query.
+func repoStatus(r unversioned.Repo, ignored bool) (*status, error) {
+	s := &status{Dir: r.Dir, VCS: r.VCS}
+	var err error
+	switch r.VCS {
+	case "git":
+		err = gitStatus(s, ignored)
+	case "hg":
+		err = hgStatus(s, ignored)
+	case "bzr":
+		err = bzrStatus(s, ignored)
+	case "svn":
+		err = svnStatus(s, ignored)
+	default:
+		return nil, nil
+	}
+	return s, err
+}
+
+func gitStatus(s *status, ignored bool) error {
+	args := []string{"status", "--porcelain", "--untracked-files=all"}
+	if ignored {
+		args = append(args, "--ignored")
+	}
+	lines, err := vcsLines(s.Dir, "git", args...)
+	if err != nil {
+		return err
+	}
+	for _, l := range lines {
+		if len(l) < 4 {
+			continue
+		}
+		switch code, name := l[:2], l[3:]; code {
+		case "??":
+			s.Untracked = append(s.Untracked, name)
+		case "!!":
+			s.Ignored = append(s.Ignored, name)
+		default:
+			s.Uncommitted = append(s.Uncommitted, l)
+		}
+	}
+	// Commits on local branches that aren't on any remote-tracking branch.
+	s.Unpushed, err = vcsLines(s.Dir, "git", "log", "--branches", "--not", "--remotes", "--oneline")
+	return err
+}
+
+func hgStatus(s *status, ignored bool) error {
+	args := []string{"status"}
+	if ignored {
+		args = append(args, "--all")
+	}
+	lines, err := vcsLines(s.Dir, "hg", args...)
+	if err != nil {
+		return err
+	}
+	for _, l := range lines {
+		if len(l) < 3 {
+			continue
+		}
+		switch code, name := l[0], l[2:]; code {
+		case '?':
+			s.Untracked = append(s.Untracked, name)
+		case 'I':
+			s.Ignored = append(s.Ignored, name)
+		case 'C':
+		default:
+			s.Uncommitted = append(s.Uncommitted, l)
+		}
+	}
+	// Draft changesets haven't been pushed to a publishing repository.
+	s.Unpushed, err = vcsLines(s.Dir, "hg", "log", "-r", "draft()", "--template", "{node|short} {desc|firstline}\n")
+	return err
+}
+
+func bzrStatus(s *status, ignored bool) error {
+	lines, err := vcsLines(s.Dir, "bzr", "status", "--short")
+	if err != nil {
+		return err
+	}
+	for _, l := range lines {
+		if strings.HasPrefix(l, "?") {
+			s.Untracked = append(s.Untracked, strings.TrimSpace(l[1:]))
+		} else {
+			s.Uncommitted = append(s.Uncommitted, l)
+		}
+	}
+	if ignored {
+		s.Ignored, err = vcsLines(s.Dir, "bzr", "ls", "--ignored")
+	}
+	// bzr can only find unpushed revisions by contacting the parent branch,
+	// which we avoid doing.
+	return err
+}
+
+func svnStatus(s *status, ignored bool) error {
+	args := []string{"status"}
+	if ignored {
+		args = append(args, "--no-ignore")
+	}
+	lines, err := vcsLines(s.Dir, "svn", args...)
+	if err != nil {
+		return err
+	}
+	for _, l := range lines {
+		if len(l) < 9 {
+			continue
+		}
+		switch code, name := l[0], strings.TrimSpace(l[8:]); code {
+		case '?':
+			s.Untracked = append(s.Untracked, name)
+		case 'I':
+			s.Ignored = append(s.Ignored, name)
+		default:
+			s.Uncommitted = append(s.Uncommitted, l)
+		}
+	}
+	// svn commits go straight to the server, so nothing is ever unpushed.
+	return nil
+}
+
+// vcsLines runs the command in dir and returns its non-empty output lines.
+func vcsLines(dir, name string, args ...string) ([]string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s %s: %v: %s", name, args[0], err, msg)
+		}
+		return nil, fmt.Errorf("%s %s: %v", name, args[0], err)
+	}
+	var lines []string
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		if l := s.Text(); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines, s.Err()
+}
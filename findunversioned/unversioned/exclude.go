@@ -0,0 +1,155 @@
+package unversioned
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// An Excluder decides whether a directory should be skipped.
+// It understands a subset of the gitignore syntax:
+//
+//	node_modules     any directory named node_modules
+//	build/cache      build/cache relative to the walk root
+//	/tmp             tmp directly under the walk root
+//	~/.cache         .cache in the home directory
+//	**/testdata/big  ** matches any number of directories
+//	!keep            re-include a previously excluded directory
+//
+// Later patterns take precedence over earlier ones.
+// Patterns starting with ~ only match in file systems that implement
+// RealPathFS.
+type Excluder struct {
+	pats []pattern
+}
+
+type pattern struct {
+	segs   []string
+	negate bool
+	anyDir bool // pattern had no slash, so it matches a name anywhere
+	abs    bool // pattern is matched against absolute paths
+}
+
+// Add adds a pattern. Blank patterns and those starting with # are ignored.
+func (e *Excluder) Add(s string) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.HasPrefix(s, "#") {
+		return
+	}
+	var p pattern
+	if strings.HasPrefix(s, "!") {
+		p.negate = true
+		s = s[1:]
+	}
+	s = strings.TrimRight(s, "/")
+	switch {
+	case s == "":
+		return
+	case s == "~" || strings.HasPrefix(s, "~/"):
+		p.abs = true
+		s = filepath.ToSlash(filepath.Join(HomeDir(), s[1:]))
+	case strings.HasPrefix(s, "/"):
+	default:
+		p.anyDir = !strings.Contains(s, "/")
+	}
+	p.segs = strings.Split(strings.TrimPrefix(s, "/"), "/")
+	e.pats = append(e.pats, p)
+}
+
+// AddFrom adds the patterns in r, one per line.
+func (e *Excluder) AddFrom(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		e.Add(s.Text())
+	}
+	return s.Err()
+}
+
+// HomeDir returns the user's home directory, from $HOME, with symbolic
+// links resolved, or "" if it isn't known. It is what ~/ stands for in
+// patterns.
+func HomeDir() string {
+	h, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	if real, err := filepath.EvalSymlinks(h); err == nil {
+		return real
+	}
+	return h
+}
+
+// Match reports whether the directory rel, a slash-separated path relative
+// to the walk root, is excluded. abs is its absolute path, or "" if unknown.
+func (e *Excluder) Match(rel, abs string) bool {
+	m := matchPath{rel: strings.Split(rel, "/")}
+	if abs != "" {
+		m.abs = splitAbs(abs)
+	}
+	return e.match(m)
+}
+
+func (e *Excluder) match(m matchPath) bool {
+	if e == nil {
+		return false
+	}
+	excluded := false
+	for _, p := range e.pats {
+		var ok bool
+		switch {
+		case p.anyDir:
+			ok, _ = path.Match(p.segs[0], m.rel[len(m.rel)-1])
+		case p.abs:
+			ok = m.abs != nil && matchSegs(p.segs, m.abs)
+		default:
+			ok = matchSegs(p.segs, m.rel)
+		}
+		if ok {
+			excluded = !p.negate
+		}
+	}
+	return excluded
+}
+
+func matchSegs(pat, segs []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for i := 0; i <= len(segs); i++ {
+				if matchSegs(pat[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], segs[0]); !ok {
+			return false
+		}
+		pat, segs = pat[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
+
+// A matchPath is a directory split into path elements, both relative to
+// the walk root and absolute. abs is nil if the absolute path is unknown.
+type matchPath struct {
+	rel []string
+	abs []string
+}
+
+func splitAbs(p string) []string {
+	return strings.Split(strings.TrimPrefix(filepath.ToSlash(p), "/"), "/")
+}
+
+func (m matchPath) Join(name string) matchPath {
+	mp := matchPath{rel: append(m.rel[:len(m.rel):len(m.rel)], name)}
+	if m.abs != nil {
+		mp.abs = append(m.abs[:len(m.abs):len(m.abs)], name)
+	}
+	return mp
+}
@@ -0,0 +1,271 @@
+// Package unversioned finds directory trees that are not under version
+// control, and so would be lost along with the disk they live on.
+//
+// A directory is versioned if it contains a marker (such as .git) named by
+// one of the rules. A directory is unversioned if it isn't versioned and
+// every directory below it is unversioned too. Find reports the largest
+// unversioned trees: when every child of a directory is unversioned, the
+// directory is reported instead of its children.
+package unversioned
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Dir describes an unversioned directory tree.
+type Dir struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`  // total size of files, in bytes
+	Files   int       `json:"files"` // number of files
+	ModTime time.Time `json:"mtime"` // most recent modification of any entry
+}
+
+func (d *Dir) add(o Dir) {
+	d.Size += o.Size
+	d.Files += o.Files
+	if o.ModTime.After(d.ModTime) {
+		d.ModTime = o.ModTime
+	}
+}
+
+// A Repo is a directory under version control.
+type Repo struct {
+	Dir string
+	VCS string // name of the matching rule, e.g. "git"
+}
+
+// A Result holds what Find found.
+type Result struct {
+	Unversioned []Dir
+	Repos       []Repo // sorted by Dir
+}
+
+// RealPathFS is implemented by file systems that can resolve a path to a
+// canonical one with all symbolic links resolved, such as an absolute path
+// in the operating system's file system.
+//
+// Finders need it to follow symbolic links and to match absolute exclude
+// patterns.
+type RealPathFS interface {
+	fs.FS
+	RealPath(name string) (string, error)
+}
+
+// A Finder finds unversioned directories using a bounded pool of
+// goroutines. Errors reading a directory are reported and the walk
+// continues with its siblings.
+//
+// A Finder may be reused across calls to Find; directories reached through
+// symbolic links are only walked once across all calls.
+type Finder struct {
+	Rules   []Rule    // nil means DefaultRules
+	Exclude *Excluder // directories to skip; may be nil
+	Workers int       // number of directories to read concurrently
+
+	// FollowLinks makes the Finder walk symbolic links to directories.
+	// It has no effect unless the file system implements RealPathFS.
+	FollowLinks bool
+
+	// OnError, if non-nil, is called for every directory that couldn't
+	// be read. Calls are serialized. If nil, Find returns the first such
+	// error.
+	OnError func(error)
+
+	mu      sync.Mutex
+	scanned []string // real paths of roots and followed symlinks
+}
+
+type walker struct {
+	*Finder
+	fsys  fs.FS
+	rfs   RealPathFS // nil if fsys can't resolve paths
+	sem   chan struct{}
+	rules *ruleSet
+
+	mu       sync.Mutex
+	repos    []Repo
+	firstErr error
+}
+
+// Find returns the unversioned directories under root in fsys.
+// Paths in the result are slash-separated and include root, as for fs.WalkDir.
+func (f *Finder) Find(fsys fs.FS, root string) (*Result, error) {
+	fi, err := fs.Stat(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return new(Result), nil
+	}
+	rules := f.Rules
+	if rules == nil {
+		rules = DefaultRules
+	}
+	workers := f.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	w := &walker{
+		Finder: f,
+		fsys:   fsys,
+		// The calling goroutine does work too.
+		sem:   make(chan struct{}, workers-1),
+		rules: newRuleSet(rules),
+	}
+	var m matchPath
+	if rfs, ok := fsys.(RealPathFS); ok {
+		w.rfs = rfs
+		if real, err := rfs.RealPath(root); err == nil {
+			f.markScanned(real)
+			m.abs = splitAbs(real)
+		}
+	}
+	nover, _ := w.walk(root, m)
+	sort.Slice(w.repos, func(i, j int) bool { return w.repos[i].Dir < w.repos[j].Dir })
+	return &Result{Unversioned: nover, Repos: w.repos}, w.firstErr
+}
+
+func (w *walker) error(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.OnError != nil {
+		w.OnError(err)
+	} else if w.firstErr == nil {
+		w.firstErr = err
+	}
+}
+
+// walk returns the unversioned directories under dir.
+// whole is true if dir itself is unversioned, in which case
+// nover holds only dir.
+func (w *walker) walk(dir string, m matchPath) (nover []Dir, whole bool) {
+	ents, err := fs.ReadDir(w.fsys, dir)
+	if err != nil {
+		w.error(err)
+		return nil, false
+	}
+	var (
+		names []string
+		self  = Dir{Path: dir}
+		vcs   = w.rules.matcher()
+	)
+	// Start from the directory's own time, so that an empty one
+	// doesn't have the zero time.
+	if fi, err := fs.Stat(w.fsys, dir); err == nil {
+		self.ModTime = fi.ModTime()
+	}
+	for _, e := range ents {
+		vcs.Add(e.Name(), e.IsDir())
+		fi, err := e.Info()
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				w.error(err)
+			}
+			continue // removed since we read the directory
+		}
+		isDir := e.IsDir()
+		if e.Type()&fs.ModeSymlink != 0 && w.FollowLinks && w.rfs != nil {
+			isDir = w.followLink(path.Join(dir, e.Name()))
+		}
+		if isDir {
+			names = append(names, e.Name())
+		} else {
+			self.Size += fi.Size()
+			self.Files++
+		}
+		if fi.ModTime().After(self.ModTime) {
+			self.ModTime = fi.ModTime()
+		}
+	}
+	if name := vcs.VCS(); name != "" {
+		w.mu.Lock()
+		w.repos = append(w.repos, Repo{Dir: dir, VCS: name})
+		w.mu.Unlock()
+		return nil, false
+	}
+	for i := 0; i < len(names); {
+		if w.Exclude.match(m.Join(names[i])) {
+			names = append(names[:i], names[i+1:]...)
+			continue
+		}
+		i++
+	}
+
+	type result struct {
+		nover []Dir
+		whole bool
+	}
+	results := make([]result, len(names))
+	var wg sync.WaitGroup
+	for i, n := range names {
+		i, child, cm := i, path.Join(dir, n), m.Join(n)
+		select {
+		case w.sem <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i].nover, results[i].whole = w.walk(child, cm)
+				<-w.sem
+			}()
+		default:
+			results[i].nover, results[i].whole = w.walk(child, cm)
+		}
+	}
+	wg.Wait()
+
+	whole = true
+	for _, r := range results {
+		nover = append(nover, r.nover...)
+		whole = whole && r.whole
+	}
+	if whole {
+		for _, d := range nover {
+			self.add(d)
+		}
+		return []Dir{self}, true
+	}
+	return nover, false
+}
+
+// followLink reports whether the symlink name refers to a directory that
+// should be walked. Directories that are already being walked, either
+// under one of the roots or through another symlink, are skipped so that
+// cycles terminate and trees aren't reported twice.
+func (w *walker) followLink(name string) bool {
+	fi, err := fs.Stat(w.fsys, name)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			w.error(err)
+		}
+		return false // dangling links are just files
+	}
+	if !fi.IsDir() {
+		return false
+	}
+	real, err := w.rfs.RealPath(name)
+	if err != nil {
+		w.error(err)
+		return false
+	}
+	return w.markScanned(real)
+}
+
+// markScanned records that the tree at real will be walked.
+// It returns false if real was already covered.
+func (f *Finder) markScanned(real string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, s := range f.scanned {
+		if real == s || strings.HasPrefix(real, strings.TrimSuffix(s, "/")+"/") {
+			return false
+		}
+	}
+	f.scanned = append(f.scanned, real)
+	return true
+}
@@ -0,0 +1,294 @@
+package unversioned
+
+import (
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var (
+	t0 = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1 = t0.Add(time.Hour)
+)
+
+func file(size int, mtime time.Time) *fstest.MapFile {
+	return &fstest.MapFile{Data: make([]byte, size), ModTime: mtime}
+}
+
+func dir(mtime time.Time) *fstest.MapFile {
+	return &fstest.MapFile{Mode: fs.ModeDir | 0755, ModTime: mtime}
+}
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		name     string
+		fsys     fstest.MapFS
+		root     string
+		rules    []Rule
+		excludes []string
+		want     []string // paths of unversioned dirs
+		repos    []Repo
+	}{
+		{
+			name: "Empty",
+			fsys: fstest.MapFS{},
+			want: []string{"."},
+		},
+		{
+			name: "EmptyDirs",
+			fsys: fstest.MapFS{
+				"a":   dir(t0),
+				"b/c": dir(t0),
+			},
+			want: []string{"."},
+		},
+		{
+			name: "FilesOnly",
+			fsys: fstest.MapFS{
+				"a.txt": file(1, t0),
+				"b.txt": file(2, t0),
+			},
+			want: []string{"."},
+		},
+		{
+			name: "RootIsRepo",
+			fsys: fstest.MapFS{
+				".git/HEAD": file(1, t0),
+				"src/a.go":  file(1, t0),
+			},
+			repos: []Repo{{".", "git"}},
+		},
+		{
+			name: "RepoAndSibling",
+			fsys: fstest.MapFS{
+				"proj/.hg/store": file(1, t0),
+				"notes/a.txt":    file(1, t0),
+				"junk":           dir(t0),
+			},
+			want:  []string{"junk", "notes"},
+			repos: []Repo{{"proj", "hg"}},
+		},
+		{
+			name: "NestedRepos",
+			fsys: fstest.MapFS{
+				"work/a/.git/HEAD":         file(1, t0),
+				"work/a/vendor/b/.git":     file(1, t0),
+				"work/b/.svn/entries":      file(1, t0),
+				"work/c/data/x":            file(1, t0),
+				"work/c/data/y/.bzr/stuff": file(1, t0),
+				"work/c/data/z/zz":         file(1, t0),
+			},
+			want: []string{"work/c/data/z"},
+			repos: []Repo{
+				{"work/a", "git"},
+				{"work/b", "svn"},
+				{"work/c/data/y", "bzr"},
+			},
+		},
+		{
+			// A child that reports several unversioned directories must
+			// not make its parent look entirely unversioned.
+			name: "MixedChildNotCollapsed",
+			fsys: fstest.MapFS{
+				"a/x/f":         file(1, t0),
+				"a/y/f":         file(1, t0),
+				"a/r/.git/HEAD": file(1, t0),
+				"b/.git/HEAD":   file(1, t0),
+			},
+			want:  []string{"a/x", "a/y"},
+			repos: []Repo{{"a/r", "git"}, {"b", "git"}},
+		},
+		{
+			name: "GitFileAndFossil",
+			fsys: fstest.MapFS{
+				"wt/.git":            file(1, t0),
+				"fos/.fslckout":      file(1, t0),
+				"notfos/.fslckout/x": file(1, t0),
+			},
+			want:  []string{"notfos"},
+			repos: []Repo{{"fos", "fossil"}, {"wt", "git"}},
+		},
+		{
+			name: "MarkerKinds",
+			fsys: fstest.MapFS{
+				"d/CVS/Root":  file(1, t0),
+				"f/CVS":       file(1, t0),
+				"s/.stfolder": dir(t0),
+			},
+			rules: append(append([]Rule(nil), DefaultRules...), SyncRules...),
+			want:  []string{"f"},
+			repos: []Repo{{"d", "cvs"}, {"s", "syncthing"}},
+		},
+		{
+			name: "FirstRuleWins",
+			fsys: fstest.MapFS{
+				"r/.jj/repo":  file(1, t0),
+				"r/.git/HEAD": file(1, t0),
+				"other/x":     file(1, t0),
+			},
+			want:  []string{"other"},
+			repos: []Repo{{"r", "git"}},
+		},
+		{
+			name: "Excludes",
+			fsys: fstest.MapFS{
+				"p/.git/HEAD":        file(1, t0),
+				"a/node_modules/x/y": file(1, t0),
+				"a/src/.git/HEAD":    file(1, t0),
+				"b/cache/z":          file(1, t0),
+				"b/keep/.git/HEAD":   file(1, t0),
+				"c/deep/tmp/q":       file(1, t0),
+				"c/deep/r/.git/HEAD": file(1, t0),
+				"d/tmp/q":            file(1, t0),
+				"d/r/.git/HEAD":      file(1, t0),
+			},
+			excludes: []string{"node_modules", "/b/cache", "**/tmp", "!d/tmp"},
+			want:     []string{"d/tmp"},
+			repos: []Repo{
+				{"a/src", "git"},
+				{"b/keep", "git"},
+				{"c/deep/r", "git"},
+				{"d/r", "git"},
+				{"p", "git"},
+			},
+		},
+		{
+			name: "SubRoot",
+			fsys: fstest.MapFS{
+				"home/u/a/x":         file(1, t0),
+				"home/u/b/.git/HEAD": file(1, t0),
+				"home/v/c":           file(1, t0),
+			},
+			root:  "home/u",
+			want:  []string{"home/u/a"},
+			repos: []Repo{{"home/u/b", "git"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ex := new(Excluder)
+			for _, p := range test.excludes {
+				ex.Add(p)
+			}
+			root := test.root
+			if root == "" {
+				root = "."
+			}
+			f := &Finder{Rules: test.rules, Exclude: ex, Workers: 4}
+			res, err := f.Find(test.fsys, root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range res.Unversioned {
+				got = append(got, d.Path)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("unversioned: got %q, want %q", got, test.want)
+			}
+			if !reflect.DeepEqual(res.Repos, test.repos) {
+				t.Errorf("repos: got %v, want %v", res.Repos, test.repos)
+			}
+		})
+	}
+}
+
+func TestFindSizes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/x":            file(10, t0),
+		"a/b/y":          file(20, t1),
+		"a/b/c/z":        file(5, t0),
+		"r/.git/HEAD":    file(100, t1),
+		"r/big":          file(1000, t1),
+		"s/only":         file(3, t0),
+		"s/.git/objects": dir(t0),
+		"e":              dir(t1),
+	}
+	res, err := new(Finder).Find(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Dir{
+		{Path: "a", Size: 35, Files: 3, ModTime: t1},
+		{Path: "e", ModTime: t1},
+	}
+	if !reflect.DeepEqual(res.Unversioned, want) {
+		t.Errorf("got %+v, want %+v", res.Unversioned, want)
+	}
+}
+
+type errFS struct {
+	fstest.MapFS
+	bad string
+}
+
+func (f errFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == f.bad {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrPermission}
+	}
+	return f.MapFS.ReadDir(name)
+}
+
+func TestFindErrors(t *testing.T) {
+	fsys := errFS{
+		MapFS: fstest.MapFS{
+			"a/locked/x": file(1, t0),
+			"a/open/y":   file(1, t0),
+			"b/z":        file(1, t0),
+		},
+		bad: "a/locked",
+	}
+
+	// Without OnError the first error is returned along with the results.
+	res, err := new(Finder).Find(fsys, ".")
+	if err == nil || !strings.Contains(err.Error(), "a/locked") {
+		t.Errorf("got error %v, want one for a/locked", err)
+	}
+	var got []string
+	for _, d := range res.Unversioned {
+		got = append(got, d.Path)
+	}
+	// a can't be known to be unversioned, but its readable children can.
+	if want := []string{"a/open", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	var errs []error
+	f := &Finder{OnError: func(err error) { errs = append(errs, err) }}
+	if _, err := f.Find(fsys, "."); err != nil {
+		t.Errorf("Find with OnError returned %v", err)
+	}
+	if len(errs) != 1 {
+		t.Errorf("OnError called %d times, want 1", len(errs))
+	}
+}
+
+func TestReadRules(t *testing.T) {
+	in := `# extra rules
+backup .backedup
+nix  .nix-root dir
+
+sync .sync file
+`
+	got, err := ReadRules(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Rule{
+		{"backup", ".backedup", ""},
+		{"nix", ".nix-root", "dir"},
+		{"sync", ".sync", "file"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, bad := range []string{"justname", "a b c d", "a b link"} {
+		if _, err := ReadRules(strings.NewReader(bad)); err == nil {
+			t.Errorf("ReadRules(%q) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package unversioned
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A Rule marks a directory as versioned if it contains an entry named Marker.
+type Rule struct {
+	Name   string // reported as the repository's VCS, e.g. "git"
+	Marker string
+	Kind   string // "dir", "file", or "" to accept either
+}
+
+// DefaultRules recognizes the common version control systems.
+var DefaultRules = []Rule{
+	{"git", ".git", ""}, // .git is a file in worktrees and submodules
+	{"hg", ".hg", "dir"},
+	{"bzr", ".bzr", "dir"},
+	{"svn", ".svn", "dir"},
+	{"fossil", ".fslckout", "file"},
+	{"fossil", "_FOSSIL_", "file"},
+	{"pijul", ".pijul", "dir"},
+	{"darcs", "_darcs", "dir"},
+	{"jj", ".jj", "dir"},
+	{"cvs", "CVS", "dir"},
+}
+
+// SyncRules treat directories kept in sync with other machines as
+// versioned, since they survive a disk failure too.
+var SyncRules = []Rule{
+	{"syncthing", ".stfolder", ""},
+}
+
+// A ruleSet finds the first rule that matches the entries of a directory.
+type ruleSet struct {
+	rules    []Rule
+	byMarker map[string][]int
+}
+
+func newRuleSet(rules []Rule) *ruleSet {
+	rs := &ruleSet{rules: rules, byMarker: make(map[string][]int)}
+	for i, r := range rules {
+		rs.byMarker[r.Marker] = append(rs.byMarker[r.Marker], i)
+	}
+	return rs
+}
+
+// A ruleMatch tracks the best rule matched by the entries seen so far.
+type ruleMatch struct {
+	rs   *ruleSet
+	best int
+}
+
+func (rs *ruleSet) matcher() ruleMatch {
+	return ruleMatch{rs: rs, best: -1}
+}
+
+func (m *ruleMatch) Add(name string, isDir bool) {
+	for _, i := range m.rs.byMarker[name] {
+		if m.best >= 0 && m.best < i {
+			return
+		}
+		switch m.rs.rules[i].Kind {
+		case "dir":
+			if !isDir {
+				continue
+			}
+		case "file":
+			if isDir {
+				continue
+			}
+		}
+		m.best = i
+		return
+	}
+}
+
+// VCS returns the name of the matched rule, or "" if none matched.
+func (m *ruleMatch) VCS() string {
+	if m.best < 0 {
+		return ""
+	}
+	return m.rs.rules[m.best].Name
+}
+
+// ReadRules reads rules from r. Each line holds a name, a marker and
+// optionally a kind (dir or file), separated by spaces.
+// Blank lines and lines starting with # are ignored.
+func ReadRules(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+	s := bufio.NewScanner(r)
+	for lineno := 1; s.Scan(); lineno++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fs := strings.Fields(line)
+		if len(fs) < 2 || len(fs) > 3 {
+			return nil, fmt.Errorf("line %d: want name, marker and optional kind", lineno)
+		}
+		r := Rule{Name: fs[0], Marker: fs[1]}
+		if len(fs) == 3 {
+			r.Kind = fs[2]
+			if r.Kind != "dir" && r.Kind != "file" {
+				return nil, fmt.Errorf("line %d: kind must be dir or file", lineno)
+			}
+		}
+		rules = append(rules, r)
+	}
+	return rules, s.Err()
+}
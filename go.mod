@@ -1,6 +1,6 @@
 module github.com/uluyol/tools
 
-go 1.14
+go 1.16
 
 require (
 	9fans.net/go v0.0.0-20180727211846-5d4fa602e1e8
@@ -0,0 +1,89 @@
+// Package colsel parses column selectors like 1,3-5,8.
+//
+// Columns are numbered from 1. Selectors are comma-separated lists of
+// columns and inclusive ranges of columns.
+package colsel
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Parse returns the sorted, 0-based indices of the columns selected by s.
+func Parse(s string) (indiv []int, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			if ee, ok := e.(error); ok {
+				err = ee
+			} else {
+				panic(e)
+			}
+		}
+	}()
+
+	groups := strings.Split(s, ",")
+	for _, g := range groups {
+		fs := strings.Split(g, "-")
+		if len(fs) == 1 {
+			indiv = append(indiv, indSingle(fs[0]))
+		} else if len(fs) == 2 {
+			indiv = append(indiv, indRange(fs[0], fs[1])...)
+		} else {
+			panic(fmt.Errorf("too many fields in range: %s", g))
+		}
+	}
+
+	indiv = indMulti(indiv)
+	return
+}
+
+func indSingle(s string) int {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		panic(err)
+	}
+	if v < 1 {
+		panic(errors.New("bad column index"))
+	}
+	return v - 1
+}
+
+func indRange(start, end string) []int {
+	vs, err := strconv.Atoi(start)
+	if err != nil {
+		panic(err)
+	}
+	if vs < 1 {
+		panic(errors.New("bad column start"))
+	}
+	ve, err := strconv.Atoi(end)
+	if err != nil {
+		panic(err)
+	}
+	if ve < 1 {
+		panic(errors.New("bad column end"))
+	}
+	var inds []int
+	for i := vs - 1; i < ve; i++ {
+		inds = append(inds, i)
+	}
+	return inds
+}
+
+func indMulti(inds []int) []int {
+	sort.Ints(inds)
+	prev := -1
+	for i := 0; i < len(inds); {
+		if inds[i] == prev {
+			inds = append(inds[:i], inds[i+1:]...)
+		} else {
+			prev = inds[i]
+			i++
+		}
+	}
+
+	return inds
+}
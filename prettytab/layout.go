@@ -0,0 +1,163 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A layout says how wide each column is and how to fit cells into it.
+type layout struct {
+	widths []int
+	right  []bool
+	max    []int // max width of each column, 0 for no limit
+	wrap   bool  // wrap cells wider than max instead of truncating them
+	o      *colOpts
+}
+
+// colOpts holds the per-column settings given on the command line.
+type colOpts struct {
+	right, left map[int]bool // forced alignments
+	auto        bool         // right-align numeric columns
+	max         map[int]int  // max widths by column; -1 for all columns
+	wrap        bool
+	minWidth    int
+}
+
+// newLayout sizes the columns to fit rows.
+func newLayout(rows [][]string, o *colOpts) *layout {
+	l := &layout{o: o, wrap: o.wrap}
+	for _, row := range rows {
+		l.grow(row)
+	}
+	for c := range l.right {
+		if o.auto && !o.right[c] && !o.left[c] {
+			l.right[c] = isNumericCol(rows, c)
+		}
+	}
+	return l
+}
+
+// grow widens the columns, adding any that are missing, to fit row.
+// It reports whether any column changed.
+func (l *layout) grow(row []string) bool {
+	grew := false
+	for c := len(l.widths); c < len(row); c++ {
+		max, ok := l.o.max[c]
+		if !ok {
+			max = l.o.max[-1]
+		}
+		l.widths = append(l.widths, l.o.minWidth)
+		l.right = append(l.right, l.o.right[c])
+		l.max = append(l.max, max)
+		grew = true
+	}
+	for c, cell := range row {
+		if w := l.cellWidth(c, cell); w > l.widths[c] {
+			l.widths[c] = w
+			grew = true
+		}
+	}
+	return grew
+}
+
+func (l *layout) cellWidth(c int, cell string) int {
+	w := 0
+	for _, line := range strings.Split(cell, "\n") {
+		if lw := width(line); lw > w {
+			w = lw
+		}
+	}
+	if l.max[c] > 0 && w > l.max[c] {
+		return l.max[c]
+	}
+	return w
+}
+
+func width(s string) int { return utf8.RuneCountInString(s) }
+
+// isNumericCol reports whether every cell in column c is a number,
+// allowing for a header in the first row and empty cells.
+func isNumericCol(rows [][]string, c int) bool {
+	numeric := false
+	for i, row := range rows {
+		if c >= len(row) || strings.TrimSpace(row[c]) == "" {
+			continue
+		}
+		if isNumber(row[c]) {
+			numeric = true
+		} else if i > 0 {
+			return false
+		}
+	}
+	return numeric
+}
+
+func isNumber(s string) bool {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "%")
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+// lines splits the cell in column c into the lines it takes up,
+// truncating or wrapping each to the column's max width.
+func (l *layout) lines(c int, cell string) []string {
+	max := 0
+	if c < len(l.max) {
+		max = l.max[c]
+	}
+	var lines []string
+	for _, line := range strings.Split(cell, "\n") {
+		switch {
+		case max <= 0 || width(line) <= max:
+			lines = append(lines, line)
+		case l.wrap:
+			lines = append(lines, wrap(line, max)...)
+		default:
+			lines = append(lines, truncate(line, max))
+		}
+	}
+	return lines
+}
+
+func truncate(s string, max int) string {
+	if max == 1 {
+		return "…"
+	}
+	return string([]rune(s)[:max-1]) + "…"
+}
+
+// wrap breaks s into lines of at most max runes, at spaces if possible.
+func wrap(s string, max int) []string {
+	var lines []string
+	rs := []rune(s)
+	for len(rs) > max {
+		brk := -1
+		for i := max; i > 0; i-- {
+			if rs[i] == ' ' {
+				brk = i
+				break
+			}
+		}
+		if brk < 0 {
+			lines = append(lines, string(rs[:max]))
+			rs = rs[max:]
+			continue
+		}
+		lines = append(lines, strings.TrimRight(string(rs[:brk]), " "))
+		rs = rs[brk+1:]
+	}
+	return append(lines, string(rs))
+}
+
+// pad pads s to the width of column c.
+func (l *layout) pad(c int, s string) string {
+	if c >= len(l.widths) {
+		return s
+	}
+	fill := strings.Repeat(" ", l.widths[c]-width(s))
+	if l.right[c] {
+		return fill + s
+	}
+	return s + fill
+}
@@ -1,13 +1,210 @@
 package main
 
 import (
+	"bufio"
+	"fmt"
 	"io"
+	"log"
 	"os"
-	"text/tabwriter"
+	"strconv"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/uluyol/tools/internal/colsel"
+)
+
+var (
+	fieldDelim = flag.StringP("field-delim", "F", "\t", "field delimiter")
+	isCSV      = flag.Bool("csv", false, "input is CSV, with fields separated by -F if given")
+	whitespace = flag.BoolP("whitespace", "s", false, "split fields on runs of whitespace")
+	rightCols  = flag.StringP("right", "r", "", "columns to right-align (1-based indexing)")
+	leftCols   = flag.StringP("left", "l", "", "columns to left-align (1-based indexing)")
+	noAuto     = flag.Bool("no-auto-align", false, "don't right-align numeric columns")
+	maxWidths  = flag.StringArrayP("max-width", "W", nil, "limit columns to a width: N for every column, or COLS=N (may be repeated)")
+	wrapCells  = flag.Bool("wrap", false, "wrap cells wider than their max width instead of truncating them")
+	styleName  = flag.StringP("style", "S", "plain", "table style: plain, box, grid, markdown, org or latex")
+	hasHeader  = flag.BoolP("header", "H", false, "set off the first row as a header")
+	stream     = flag.BoolP("stream", "f", false, "print rows as they arrive, sizing columns from a sample of the first rows")
+	sampleRows = flag.Int("sample", 20, "stream: number of rows to size columns from")
+	sampleTime = flag.Duration("sample-time", time.Second, "stream: longest to wait for the sample rows")
 )
 
+const desc = `
+prettytab reads a table from stdin and prints it with aligned columns.
+Fields are separated by tabs unless told otherwise. Numeric columns are
+right-aligned.
+
+Tables can be drawn with Unicode box-drawing characters or ASCII, or
+written as Markdown, org-mode or LaTeX tables. Markdown tables always
+have a header. Cells in Markdown and LaTeX tables can't span lines, so
+cells with line breaks are joined and --wrap has no effect.
+
+Tables are printed once all of the input has been read, unless --stream
+is given. Streamed tables size columns from the first rows, or those
+that arrive within --sample-time, and grow them as needed by ending the
+table and starting a wider one, with the header again.
+
+Select columns by separating them with commas and giving ranges using -.
+For example, -W 3-4,6=20 limits columns 3, 4, and 6 to 20 characters.`
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: prettytab [options] < table")
+	flag.PrintDefaults()
+	fmt.Fprintln(os.Stderr, desc)
+	os.Exit(2)
+}
+
 func main() {
-	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
-	io.Copy(tw, os.Stdin)
-	tw.Flush()
+	log.SetPrefix("prettytab: ")
+	log.SetFlags(0)
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 0 {
+		usage()
+	}
+	st := styles[*styleName]
+	if st == nil {
+		log.Fatalf("unknown style %q", *styleName)
+	}
+	o, err := parseColOpts()
+	if err != nil {
+		log.Fatal(err)
+	}
+	o.minWidth = st.minWidth
+	if st.oneLine {
+		o.wrap = false
+	}
+	if !*isCSV && *fieldDelim == "" {
+		log.Fatal("empty field delimiter")
+	}
+	delim := *fieldDelim
+	if *isCSV && !flag.CommandLine.Changed("field-delim") {
+		delim = ","
+	}
+	sp := newSplitter(os.Stdin, delim, *isCSV, *whitespace)
+	header := *hasHeader || st.alwaysHeader
+	w := bufio.NewWriter(os.Stdout)
+	if *stream {
+		if *sampleRows < 1 {
+			log.Fatal("--sample must be at least 1")
+		}
+		err := streamTable(w, sp, o, st, header, *sampleRows, *sampleTime)
+		if ferr := w.Flush(); err == nil {
+			err = ferr
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	rows, err := readAll(sp)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, row := range rows {
+		st.prepare(row)
+	}
+	writeTable(w, rows, newLayout(rows, o), st, header)
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parseColOpts() (*colOpts, error) {
+	o := &colOpts{
+		right: make(map[int]bool),
+		left:  make(map[int]bool),
+		auto:  !*noAuto,
+		max:   make(map[int]int),
+		wrap:  *wrapCells,
+	}
+	for _, sel := range []struct {
+		s string
+		m map[int]bool
+	}{{*rightCols, o.right}, {*leftCols, o.left}} {
+		if sel.s == "" {
+			continue
+		}
+		cols, err := colsel.Parse(sel.s)
+		if err != nil {
+			return nil, fmt.Errorf("bad column selector: %v", err)
+		}
+		for _, c := range cols {
+			sel.m[c] = true
+		}
+	}
+	for _, mw := range *maxWidths {
+		cols := []int{-1}
+		s := mw
+		if i := strings.IndexByte(mw, '='); i >= 0 {
+			var err error
+			if cols, err = colsel.Parse(mw[:i]); err != nil {
+				return nil, fmt.Errorf("bad column selector: %v", err)
+			}
+			s = mw[i+1:]
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("bad max width %q", mw)
+		}
+		for _, c := range cols {
+			o.max[c] = n
+		}
+	}
+	return o, nil
+}
+
+// writeTable writes rows in style st. If header is set, the first row
+// is set off from the rest. With no rows, it writes nothing, not even
+// the rules around the table.
+func writeTable(w io.Writer, rows [][]string, l *layout, st *style, header bool) {
+	if len(rows) == 0 {
+		return
+	}
+	if st.top != nil {
+		fmt.Fprintln(w, st.top(l))
+	}
+	for i, row := range rows {
+		writeRow(w, row, l, st)
+		if i == 0 && header && st.header != nil {
+			fmt.Fprintln(w, st.header(l))
+		}
+	}
+	if st.bottom != nil {
+		fmt.Fprintln(w, st.bottom(l))
+	}
+}
+
+// writeRow writes the lines of a row. Rows with fewer cells than the
+// table has columns are filled with empty ones.
+func writeRow(w io.Writer, row []string, l *layout, st *style) {
+	var cells [][]string
+	height := 1
+	for c := 0; c < len(l.widths) || c < len(row); c++ {
+		ls := []string{""}
+		if c < len(row) {
+			ls = l.lines(c, row[c])
+		}
+		cells = append(cells, ls)
+		if len(ls) > height {
+			height = len(ls)
+		}
+	}
+	for i := 0; i < height; i++ {
+		var b strings.Builder
+		b.WriteString(st.left)
+		for c, ls := range cells {
+			if c > 0 {
+				b.WriteString(st.sep)
+			}
+			s := ""
+			if i < len(ls) {
+				s = ls[i]
+			}
+			b.WriteString(l.pad(c, s))
+		}
+		b.WriteString(st.right)
+		fmt.Fprintln(w, strings.TrimRight(b.String(), " "))
+	}
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// A splitter reads rows of cells.
+type splitter interface {
+	Read() ([]string, error)
+}
+
+// lineSplitter splits each line with split.
+type lineSplitter struct {
+	s     *bufio.Scanner
+	split func(string) []string
+}
+
+func (l *lineSplitter) Read() ([]string, error) {
+	if !l.s.Scan() {
+		if err := l.s.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	return l.split(strings.TrimRight(l.s.Text(), "\r")), nil
+}
+
+// newSplitter returns a splitter for input that is CSV, split on runs of
+// whitespace, or split on delim.
+func newSplitter(r io.Reader, delim string, isCSV, whitespace bool) splitter {
+	if isCSV {
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		if c, _ := utf8.DecodeRuneInString(delim); delim != "" {
+			cr.Comma = c
+		}
+		return cr
+	}
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	if whitespace {
+		return &lineSplitter{s, strings.Fields}
+	}
+	return &lineSplitter{s, func(line string) []string {
+		return strings.Split(line, delim)
+	}}
+}
+
+// readAll reads every row.
+func readAll(sp splitter) ([][]string, error) {
+	var rows [][]string
+	for {
+		row, err := sp.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, err
+		}
+		rows = append(rows, row)
+	}
+}
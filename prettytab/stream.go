@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+)
+
+// streamTable writes rows from sp as they arrive. Columns are sized
+// from the first n rows, or those read within wait of the first one,
+// and are widened if later rows don't fit, at which point the table is
+// ended and a new one started.
+func streamTable(w *bufio.Writer, sp splitter, o *colOpts, st *style, header bool, n int, wait time.Duration) error {
+	rows := make(chan []string)
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			row, err := sp.Read()
+			if err != nil {
+				errc <- err
+				close(rows)
+				return
+			}
+			rows <- row
+		}
+	}()
+
+	var (
+		sample  [][]string
+		timeout <-chan time.Time
+	)
+sample:
+	for len(sample) < n {
+		select {
+		case row, ok := <-rows:
+			if !ok {
+				break sample
+			}
+			st.prepare(row)
+			sample = append(sample, row)
+			if timeout == nil {
+				timeout = time.After(wait)
+			}
+		case <-timeout:
+			break sample
+		}
+	}
+	if len(sample) == 0 {
+		return readErr(<-errc)
+	}
+	l := newLayout(sample, o)
+	var headRow []string
+	if header {
+		headRow, sample = sample[0], sample[1:]
+	}
+	writeTop(w, headRow, l, st)
+	for _, row := range sample {
+		writeRow(w, row, l, st)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for row := range rows {
+		st.prepare(row)
+		prev := *l
+		prev.widths = append([]int(nil), l.widths...)
+		if l.grow(row) {
+			// End the table drawn so far and start a wider one.
+			// Styles with no bottom, like markdown, can't have a
+			// second header mid-table, so a blank line separates
+			// the tables.
+			if st.bottom != nil {
+				fmt.Fprintln(w, st.bottom(&prev))
+			} else {
+				fmt.Fprintln(w)
+			}
+			writeTop(w, headRow, l, st)
+		}
+		writeRow(w, row, l, st)
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	if st.bottom != nil {
+		fmt.Fprintln(w, st.bottom(l))
+	}
+	return readErr(<-errc)
+}
+
+// writeTop draws the top of a table and its header row, if not nil.
+func writeTop(w *bufio.Writer, headRow []string, l *layout, st *style) {
+	if st.top != nil {
+		fmt.Fprintln(w, st.top(l))
+	}
+	if headRow != nil {
+		writeRow(w, headRow, l, st)
+		if st.header != nil {
+			fmt.Fprintln(w, st.header(l))
+		}
+	}
+}
+
+// readErr returns err unless it marks the end of the input.
+func readErr(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+)
+
+// A style says how to draw a table around the padded cells.
+type style struct {
+	left, sep, right string // around and between the cells of a line
+
+	// Lines drawn above the table, below the header and below the
+	// table, if not nil.
+	top, header, bottom func(l *layout) string
+
+	escape       func(string) string // applied to cells, if not nil
+	oneLine      bool                // cells can't span lines
+	minWidth     int                 // of every column
+	alwaysHeader bool                // the first row is always a header
+}
+
+var styles = map[string]*style{
+	"plain": {
+		sep:    "  ",
+		header: rule("", "-", "  ", "", 0),
+	},
+	"box": {
+		left:   "│ ",
+		sep:    " │ ",
+		right:  " │",
+		top:    rule("┌", "─", "┬", "┐", 2),
+		header: rule("├", "─", "┼", "┤", 2),
+		bottom: rule("└", "─", "┴", "┘", 2),
+	},
+	"grid": {
+		left:   "| ",
+		sep:    " | ",
+		right:  " |",
+		top:    rule("+", "-", "+", "+", 2),
+		header: rule("+", "=", "+", "+", 2),
+		bottom: rule("+", "-", "+", "+", 2),
+	},
+	"markdown": {
+		left:         "| ",
+		sep:          " | ",
+		right:        " |",
+		header:       markdownRule,
+		escape:       strings.NewReplacer(`|`, `\|`).Replace,
+		oneLine:      true,
+		minWidth:     3,
+		alwaysHeader: true,
+	},
+	"org": {
+		left:   "| ",
+		sep:    " | ",
+		right:  " |",
+		header: rule("|", "-", "+", "|", 2),
+		escape: strings.NewReplacer(`|`, `\vert{}`).Replace,
+	},
+	"latex": {
+		sep:     " & ",
+		right:   ` \\`,
+		top:     latexBegin,
+		header:  func(*layout) string { return `\hline` },
+		bottom:  func(*layout) string { return `\end{tabular}` },
+		escape:  latexEscape,
+		oneLine: true,
+	},
+}
+
+// rule returns a function that draws a horizontal line across the
+// columns, each extra wider than its cells.
+func rule(left, fill, cross, right string, extra int) func(l *layout) string {
+	return func(l *layout) string {
+		segs := make([]string, len(l.widths))
+		for c, w := range l.widths {
+			segs[c] = strings.Repeat(fill, w+extra)
+		}
+		return left + strings.Join(segs, cross) + right
+	}
+}
+
+// markdownRule draws the line below a Markdown header, which also
+// gives each column's alignment.
+func markdownRule(l *layout) string {
+	segs := make([]string, len(l.widths))
+	for c, w := range l.widths {
+		if l.right[c] {
+			segs[c] = strings.Repeat("-", w-1) + ":"
+		} else {
+			segs[c] = strings.Repeat("-", w)
+		}
+	}
+	return "| " + strings.Join(segs, " | ") + " |"
+}
+
+func latexBegin(l *layout) string {
+	var spec strings.Builder
+	for c := range l.widths {
+		if l.right[c] {
+			spec.WriteByte('r')
+		} else {
+			spec.WriteByte('l')
+		}
+	}
+	return `\begin{tabular}{` + spec.String() + `}`
+}
+
+var latexEscape = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`&`, `\&`,
+	`%`, `\%`,
+	`$`, `\$`,
+	`#`, `\#`,
+	`_`, `\_`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`~`, `\textasciitilde{}`,
+	`^`, `\textasciicircum{}`,
+).Replace
+
+// prepare makes the cells of row fit for st.
+func (st *style) prepare(row []string) {
+	for c, cell := range row {
+		if st.oneLine {
+			cell = strings.Join(strings.Fields(cell), " ")
+		}
+		if st.escape != nil {
+			cell = st.escape(cell)
+		}
+		row[c] = cell
+	}
+}
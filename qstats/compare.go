@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// A comparison reports how statistics changed between two samples.
+type comparison struct {
+	samples    [2]*summary // old, new
+	stats      []stat
+	interp     quantileFunc
+	nBoot      int
+	confidence float64
+	alpha      float64
+	test       *sigTest
+	vf         valueFormat
+}
+
+// noCI lists statistics that depend on the sample size or the sketch
+// rather than the distribution, so an interval for them means nothing.
+var noCI = map[string]bool{"count": true, "sum": true, "rankerr": true}
+
+func fmtPct(v float64) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "?"
+	}
+	return strconv.FormatFloat(v, 'f', 2, 64) + "%"
+}
+
+func (c *comparison) write(w io.Writer, format string) error {
+	a, b := c.samples[0], c.samples[1]
+	if a.count == 0 || b.count == 0 {
+		return fmt.Errorf("compare needs values in both samples")
+	}
+	boots := c.bootstrap()
+	lo, hi := (1-c.confidence)/2, 1-(1-c.confidence)/2
+	ciName := strconv.FormatFloat(100*c.confidence, 'f', -1, 64) + "% CI"
+
+	header := []string{"stat", "old", "new", "delta", ciName, ""}
+	var (
+		recs [][]string
+		cis  [][]float64 // the bounds of each interval, if any
+	)
+	for i, st := range c.stats {
+		va, vb := st.get(a), st.get(b)
+		rec := []string{st.name, c.vf.format(st, va, 6), c.vf.format(st, vb, 6), fmtDelta(va, vb), "", ""}
+		cis = append(cis, nil)
+		if d := boots[i]; d != nil {
+			sort.Float64s(d)
+			l, h := getPercentile(d, lo), getPercentile(d, hi)
+			cis[i] = []float64{l, h}
+			rec[4] = "[" + fmtPct(100*l) + ", " + fmtPct(100*h) + "]"
+			// The change is significant if the interval excludes zero.
+			if l > 0 || h < 0 {
+				rec[5] = "*"
+			}
+		}
+		recs = append(recs, rec)
+	}
+
+	p := c.test.fn(a.Values(), b.Values())
+	verdict := "no significant difference"
+	if p < c.alpha {
+		verdict = "significant difference"
+	}
+	footer := fmt.Sprintf("%s: p=%.4g n=%v+%v, %s at alpha=%v",
+		c.test.name, p, a.count, b.count, verdict, c.alpha)
+
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+		for _, rec := range recs {
+			fmt.Fprintln(tw, strings.Join(rec, "\t"))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintln(w, "\n"+footer)
+		return err
+	case "tsv", "csv":
+		// The test result becomes a final row.
+		header[5] = "significant"
+		recs = append(recs, []string{c.test.name, "", "", "", "p=" + strconv.FormatFloat(p, 'g', 4, 64), ""})
+		if p < c.alpha {
+			recs[len(recs)-1][5] = "*"
+		}
+		if format == "tsv" {
+			for _, rec := range append([][]string{header}, recs...) {
+				if _, err := fmt.Fprintln(w, strings.Join(rec, "\t")); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		cw := csv.NewWriter(w)
+		cw.Write(header)
+		cw.WriteAll(recs)
+		return cw.Error()
+	case "kv":
+		// A line for each statistic, then one for the test.
+		for i, rec := range recs {
+			line := "stat=" + kvQuote(rec[0]) + " old=" + kvQuote(rec[1]) + " new=" + kvQuote(rec[2]) + " delta=" + rec[3]
+			if cis[i] != nil {
+				line += fmt.Sprintf(" ci=%s significant=%t", kvQuote(rec[4]), rec[5] != "")
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintf(w, "test=%s p=%.4g n=%v+%v alpha=%v significant=%t\n",
+			kvQuote(c.test.name), p, a.count, b.count, c.alpha, p < c.alpha)
+		return err
+	case "json":
+		return c.writeJSON(w, cis, p)
+	}
+	return fmt.Errorf("compare doesn't support %s output", format)
+}
+
+// writeJSON writes the comparison as an object with the old and new
+// values of each statistic, the relative change and its interval in
+// percent, and the result of the test. Values are plain numbers, or
+// null if JSON can't represent them.
+func (c *comparison) writeJSON(w io.Writer, cis [][]float64, p float64) error {
+	a, b := c.samples[0], c.samples[1]
+	vf := c.vf
+	vf.human = nil
+	num := func(s string, v float64) string {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "null"
+		}
+		return s
+	}
+	pct := func(v float64) string {
+		return num(strconv.FormatFloat(100*v, 'g', -1, 64), v)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`{"stats":[`)
+	for i, st := range c.stats {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		va, vb := st.get(a), st.get(b)
+		fmt.Fprintf(&buf, `{"stat":%s,"old":%s,"new":%s,"delta_pct":%s`,
+			jsonString(st.name), num(vf.format(st, va, -1), va), num(vf.format(st, vb, -1), vb),
+			pct((vb-va)/math.Abs(va)))
+		if ci := cis[i]; ci != nil {
+			fmt.Fprintf(&buf, `,"ci_pct":[%s,%s],"significant":%t`, pct(ci[0]), pct(ci[1]), ci[0] > 0 || ci[1] < 0)
+		}
+		buf.WriteString("}")
+	}
+	fmt.Fprintf(&buf, `],"test":%s,"p":%s,"n":[%v,%v],"alpha":%v,"significant":%t}`+"\n",
+		jsonString(c.test.name), num(strconv.FormatFloat(p, 'g', -1, 64), p), a.count, b.count, c.alpha, p < c.alpha)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// fmtDelta returns the relative change from a to b.
+func fmtDelta(a, b float64) string {
+	d := 100 * (b - a) / math.Abs(a)
+	if d > 0 {
+		return "+" + fmtPct(d)
+	}
+	return fmtPct(d)
+}
+
+// bootstrap returns, for each statistic, the relative changes
+// (new-old)/|old| seen when resampling both samples with replacement.
+// Entries for statistics without intervals are nil.
+func (c *comparison) bootstrap() [][]float64 {
+	rng := rand.New(rand.NewSource(1))
+	deltas := make([][]float64, len(c.stats))
+	if c.nBoot <= 0 {
+		return deltas
+	}
+	for i, st := range c.stats {
+		if !noCI[st.name] {
+			deltas[i] = make([]float64, 0, c.nBoot)
+		}
+	}
+	a, b := c.samples[0].Values(), c.samples[1].Values()
+	for n := 0; n < c.nBoot; n++ {
+		ra, rb := c.resample(rng, a), c.resample(rng, b)
+		for i, st := range c.stats {
+			if deltas[i] == nil {
+				continue
+			}
+			va, vb := st.get(ra), st.get(rb)
+			if d := (vb - va) / math.Abs(va); !math.IsNaN(d) && !math.IsInf(d, 0) {
+				deltas[i] = append(deltas[i], d)
+			}
+		}
+	}
+	for i := range deltas {
+		if deltas[i] != nil && len(deltas[i]) == 0 {
+			deltas[i] = nil
+		}
+	}
+	return deltas
+}
+
+func (c *comparison) resample(rng *rand.Rand, vals []float64) *summary {
+	s := newSummary(nil, c.interp)
+	for range vals {
+		s.Add(vals[rng.Intn(len(vals))])
+	}
+	return s
+}
+
+// A sigTest computes the p-value of the hypothesis that two samples
+// come from the same distribution.
+type sigTest struct {
+	name string
+	fn   func(a, b []float64) float64
+}
+
+var sigTests = map[string]*sigTest{
+	"mwu":   {"Mann-Whitney U", mannWhitneyU},
+	"welch": {"Welch's t-test", welchT},
+}
+
+// mannWhitneyU returns the two-sided p-value of the Mann-Whitney U test
+// using the normal approximation with corrections for ties and continuity.
+// a and b must be sorted.
+func mannWhitneyU(a, b []float64) float64 {
+	n1, n2 := float64(len(a)), float64(len(b))
+	n := n1 + n2
+
+	// Merge the samples, assigning tied values their average rank.
+	var (
+		r1      float64 // sum of ranks of a
+		tieTerm float64 // sum of t^3-t over groups of t ties
+	)
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		var v float64
+		if j >= len(b) || (i < len(a) && a[i] <= b[j]) {
+			v = a[i]
+		} else {
+			v = b[j]
+		}
+		start := float64(i + j + 1)
+		var ta int
+		for i < len(a) && a[i] == v {
+			i++
+			ta++
+		}
+		for j < len(b) && b[j] == v {
+			j++
+		}
+		t := float64(i+j+1) - start
+		rank := start + (t-1)/2
+		r1 += float64(ta) * rank
+		tieTerm += t*t*t - t
+	}
+	u := r1 - n1*(n1+1)/2
+	mu := n1 * n2 / 2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - tieTerm/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	z := math.Max(math.Abs(u-mu)-0.5, 0) / sigma
+	return math.Erfc(z / math.Sqrt2)
+}
+
+// welchT returns the two-sided p-value of Welch's t-test.
+func welchT(a, b []float64) float64 {
+	ma, va := meanVar(a)
+	mb, vb := meanVar(b)
+	na, nb := float64(len(a)), float64(len(b))
+	sa, sb := va/na, vb/nb
+	if sa+sb == 0 {
+		if ma == mb {
+			return 1
+		}
+		return 0
+	}
+	t := (ma - mb) / math.Sqrt(sa+sb)
+	df := (sa + sb) * (sa + sb) / (sa*sa/(na-1) + sb*sb/(nb-1))
+	return regIncBeta(df/2, 0.5, df/(df+t*t))
+}
+
+func meanVar(vals []float64) (mean, variance float64) {
+	s := newSummary(nil, nil)
+	for _, v := range vals {
+		s.Add(v)
+	}
+	sd := s.Stddev()
+	return s.Mean(), sd * sd
+}
+
+// regIncBeta returns the regularized incomplete beta function I_x(a, b),
+// evaluated with the continued fraction from Numerical Recipes.
+func regIncBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	if x < (a+1)/(a+b+2) {
+		return front * betaCF(a, b, x) / a
+	}
+	return 1 - front*betaCF(b, a, 1-x)/b
+}
+
+func betaCF(a, b, x float64) float64 {
+	const (
+		maxIter = 300
+		eps     = 1e-14
+		tiny    = 1e-300
+	)
+	qab, qap, qam := a+b, a+1, a-1
+	c, d := 1.0, 1-qab*x/qap
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= maxIter; m++ {
+		m := float64(m)
+		m2 := 2 * m
+		aa := m * (b - m) * x / ((qam + m2) * (a + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+		aa = -(a + m) * (qab + m) * x / ((a + m2) * (qap + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < eps {
+			break
+		}
+	}
+	return h
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func seq(lo, hi float64) []float64 {
+	var vals []float64
+	for v := lo; v <= hi; v++ {
+		vals = append(vals, v)
+	}
+	return vals
+}
+
+func nearTol(got, want, tol float64) bool {
+	return math.Abs(got-want) <= tol
+}
+
+// The expected values were computed separately: Welch's p-values and
+// the incomplete beta function by numerical integration, and
+// Mann-Whitney's p-values by ranking with a brute force search for ties.
+
+func TestWelchT(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		{"Shifted", seq(1, 20), seq(4, 23), 0.11709008},
+		{"UnequalVariance", []float64{1, 2, 3, 4, 5, 9}, []float64{3.5, 6, 7, 8, 8.5, 10, 12}, 0.03117204},
+		{"Same", seq(1, 10), seq(1, 10), 1},
+		{"ConstantEqual", []float64{2, 2, 2}, []float64{2, 2}, 1},
+		{"ConstantDiffer", []float64{2, 2, 2}, []float64{3, 3}, 0},
+	}
+	for _, test := range tests {
+		if got := welchT(test.a, test.b); !nearTol(got, test.want, 1e-6) {
+			t.Errorf("%s: p = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		{"Ties", []float64{1, 2, 2, 3, 4, 4, 4, 7}, []float64{2, 3, 4, 5, 5, 6, 8, 9, 9}, 0.05792767},
+		{"Separated", []float64{1, 2, 3}, []float64{4, 5, 6}, 0.08085560},
+		{"AllTied", []float64{5, 5, 5}, []float64{5, 5}, 1},
+	}
+	for _, test := range tests {
+		if got := mannWhitneyU(test.a, test.b); !nearTol(got, test.want, 1e-7) {
+			t.Errorf("%s: p = %v, want %v", test.name, got, test.want)
+		}
+		// The test is symmetric.
+		if got := mannWhitneyU(test.b, test.a); !nearTol(got, test.want, 1e-7) {
+			t.Errorf("%s swapped: p = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRegIncBeta(t *testing.T) {
+	// I_x(2, 3) = 6x^2 - 8x^3 + 3x^4.
+	i23 := func(x float64) float64 { return 6*x*x - 8*x*x*x + 3*x*x*x*x }
+	tests := []struct {
+		a, b, x float64
+		want    float64
+	}{
+		{2, 3, 0, 0},
+		{2, 3, 1, 1},
+		{2, 3, -0.5, 0},
+		{2, 3, 1.5, 1},
+		{1, 1, 0.3, 0.3},
+		{3, 1, 0.5, 0.125},
+		{1, 4, 0.5, 1 - math.Pow(0.5, 4)},
+		{2, 3, 0.2, i23(0.2)},
+		{2, 3, 0.9, i23(0.9)},
+		{7.5, 7.5, 0.5, 0.5},
+		// Above (a+1)/(a+b+2), where the symmetry relation is used.
+		{19, 0.5, 0.95, 0.16544066043},
+	}
+	for _, test := range tests {
+		got := regIncBeta(test.a, test.b, test.x)
+		if !nearTol(got, test.want, 1e-10) {
+			t.Errorf("I_%v(%v, %v) = %v, want %v", test.x, test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestBootstrapDeterministic(t *testing.T) {
+	stats, err := parseStats("mean,pct50,count,sum", nil, 1.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newComparison := func(nBoot int) *comparison {
+		return &comparison{
+			samples: [2]*summary{summarize(seq(1, 30)...), summarize(seq(5, 40)...)},
+			stats:   stats,
+			interp:  getPercentile,
+			nBoot:   nBoot,
+		}
+	}
+	first := newComparison(200).bootstrap()
+	if again := newComparison(200).bootstrap(); !reflect.DeepEqual(first, again) {
+		t.Error("bootstrap gave different results with the same seed")
+	}
+	for i, st := range stats {
+		switch {
+		case noCI[st.name] && first[i] != nil:
+			t.Errorf("%s has an interval", st.name)
+		case !noCI[st.name] && len(first[i]) != 200:
+			t.Errorf("%s has %d resamples, want 200", st.name, len(first[i]))
+		}
+	}
+	for i, d := range newComparison(0).bootstrap() {
+		if d != nil {
+			t.Errorf("%s has resamples with --bootstrap=0", stats[i].name)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// writeCDF writes the points of the empirical CDF of the sorted vals as
+// fraction,value lines, in the same format as bin/mkcdf used to.
+func writeCDF(w io.Writer, vals []float64) error {
+	bw := bufio.NewWriter(w)
+	n := float64(len(vals))
+	for i := 1; i < len(vals); i++ {
+		if vals[i] != vals[i-1] {
+			fmt.Fprintf(bw, "%f,%f\n", float64(i)/n, vals[i-1])
+		}
+	}
+	if len(vals) > 0 {
+		fmt.Fprintf(bw, "1,%s\n", pyRepr(vals[len(vals)-1]))
+	}
+	return bw.Flush()
+}
+
+// pyRepr formats v the way Python's repr does.
+func pyRepr(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "nan"
+	case math.IsInf(v, 1):
+		return "inf"
+	case math.IsInf(v, -1):
+		return "-inf"
+	}
+	if a := math.Abs(v); a != 0 && (a < 1e-4 || a >= 1e16) {
+		return strconv.FormatFloat(v, 'e', -1, 64)
+	}
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+// A histogram counts values in equal-width buckets, which are equally
+// wide in log space if log is set.
+type histogram struct {
+	lo, hi float64
+	log    bool
+	counts []int
+}
+
+func newHistogram(vals []float64, nbuckets int, log bool) (*histogram, error) {
+	if len(vals) == 0 {
+		return nil, errors.New("no values to plot")
+	}
+	if nbuckets < 1 {
+		return nil, errors.New("need at least one bucket")
+	}
+	h := &histogram{lo: vals[0], hi: vals[len(vals)-1], log: log}
+	if math.IsInf(h.lo, 0) || math.IsInf(h.hi, 0) {
+		return nil, errors.New("can't plot infinite values")
+	}
+	if log && h.lo <= 0 {
+		return nil, errors.New("log-scale buckets need positive values")
+	}
+	if h.lo == h.hi {
+		nbuckets = 1
+	}
+	h.counts = make([]int, nbuckets)
+	lo, hi := h.scale(h.lo), h.scale(h.hi)
+	for _, v := range vals {
+		var i int
+		if lo != hi {
+			i = int(float64(nbuckets) * (h.scale(v) - lo) / (hi - lo))
+		}
+		// The maximum goes in the last bucket, and rounding can push
+		// values just past either end.
+		if i >= nbuckets {
+			i = nbuckets - 1
+		} else if i < 0 {
+			i = 0
+		}
+		h.counts[i]++
+	}
+	return h, nil
+}
+
+func (h *histogram) scale(v float64) float64 {
+	if h.log {
+		return math.Log(v)
+	}
+	return v
+}
+
+// bound returns the lower bound of bucket i.
+func (h *histogram) bound(i int) float64 {
+	if i == len(h.counts) {
+		return h.hi
+	}
+	lo, hi := h.scale(h.lo), h.scale(h.hi)
+	b := lo + (hi-lo)*float64(i)/float64(len(h.counts))
+	if h.log {
+		return math.Exp(b)
+	}
+	return b
+}
+
+// Write draws the histogram with bars at most width characters long.
+// Each line shows a bucket's range, count and bar.
+func (h *histogram) Write(w io.Writer, width int, vf valueFormat) error {
+	maxCount := 0
+	for _, c := range h.counts {
+		if c > maxCount {
+			maxCount = c
+		}
+	}
+	st := stat{name: "value"}
+	tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', tabwriter.AlignRight)
+	for i, c := range h.counts {
+		closing := ")"
+		if i == len(h.counts)-1 {
+			closing = "]"
+		}
+		bar := int(math.Round(float64(width) * float64(c) / float64(maxCount)))
+		fmt.Fprintf(tw, "[%s,\t%s%s\t%d\t %s\n",
+			vf.format(st, h.bound(i), 4), vf.format(st, h.bound(i+1), 4), closing,
+			c, strings.Repeat("#", bar))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	tests := []struct {
+		name     string
+		vals     []float64
+		nbuckets int
+		log      bool
+		want     []int
+	}{
+		{"Even", []float64{0, 1, 2, 3}, 2, false, []int{2, 2}},
+		{"MaxInLast", []float64{0, 1, 2, 3, 4}, 4, false, []int{1, 1, 1, 2}},
+		{"AllSame", []float64{5, 5, 5}, 10, false, []int{3}},
+		{"Log", []float64{1, 10, 100, 1000}, 3, true, []int{1, 1, 2}},
+	}
+	for _, test := range tests {
+		h, err := newHistogram(test.vals, test.nbuckets, test.log)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(h.counts, test.want) {
+			t.Errorf("%s: counts = %v, want %v", test.name, h.counts, test.want)
+		}
+	}
+}
+
+func TestHistogramErrors(t *testing.T) {
+	inf := math.Inf(1)
+	tests := []struct {
+		name string
+		vals []float64
+		log  bool
+	}{
+		{"Empty", nil, false},
+		{"Inf", []float64{1, 2, inf}, false},
+		{"NegInf", []float64{-inf, 1, 2}, false},
+		{"LogZero", []float64{0, 1}, true},
+	}
+	for _, test := range tests {
+		if _, err := newHistogram(test.vals, 10, test.log); err == nil {
+			t.Errorf("%s: newHistogram succeeded, want error", test.name)
+		}
+	}
+}
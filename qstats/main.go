@@ -1,87 +1,287 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"log"
-	"math"
 	"os"
-	"sort"
-	"strconv"
 	"strings"
-	"text/tabwriter"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/uluyol/tools/internal/colsel"
 )
 
-func getPercentile(vals []float64, pct float64) float64 {
-	if len(vals) == 0 {
-		return math.NaN()
-	}
-	k := float64(len(vals)-1) * pct
-	f := math.Floor(k)
-	c := math.Ceil(k)
-	if f == c {
-		return vals[int(k)]
-	}
-	d0 := vals[int(f)] * (c - k)
-	d1 := vals[int(c)] * (k - f)
-	return d0 + d1
+var (
+	stream      = flag.BoolP("stream", "s", false, "use a constant-memory quantile sketch instead of keeping every value")
+	rankError   = flag.Float64P("rank-error", "e", 0.01, "with --stream, target normalized rank error of quantiles")
+	fieldDelim  = flag.StringP("field-delim", "F", "", "field delimiter for tabular input (default whitespace)")
+	colSelector = flag.StringP("cols", "c", "1", "numeric columns to summarize (1-based indexing)")
+	groupBy     = flag.StringP("group", "g", "", "key columns to group rows by (1-based indexing)")
+	hasHeader   = flag.BoolP("header", "H", false, "input has a header row naming the columns")
+	pctList     = flag.StringP("pct", "p", "25,50,75,90,95,99", "percentiles to report")
+	statList    = flag.StringP("stats", "S", defaultStats, "statistics to report; pcts stands for the --pct list")
+	method      = flag.StringP("method", "m", "linear", "percentile method: linear (type7), nearest, or nearest-rank (type1)")
+	precision   = flag.IntP("precision", "P", -1, "digits after the decimal point (-1 for as many as needed)")
+	format      = flag.StringP("format", "o", "table", "output format: table, tsv, csv, json or kv")
+	comment     = flag.String("comment", "", "skip lines starting with this string")
+	skipBlank   = flag.BoolP("skip-blank", "b", false, "skip blank lines")
+	onBad       = flag.String("on-bad", "fail", "what to do with bad values: fail, or skip the line and report it")
+	cdf         = flag.Bool("cdf", false, "print the points of the empirical CDF as fraction,value lines instead of statistics")
+	hist        = flag.Bool("hist", false, "draw a histogram instead of printing statistics")
+	histBuckets = flag.Int("buckets", 20, "hist: number of buckets")
+	histLog     = flag.Bool("log", false, "hist: make buckets equally wide on a log scale")
+	histWidth   = flag.Int("width", 60, "hist: length of the longest bar")
+	fence       = flag.Float64("fence", 1.5, "count values this many interquartile ranges beyond the quartiles as outliers")
+	outliers    = flag.Bool("outliers", false, "print the outliers with their line numbers instead of statistics")
+	unitName    = flag.StringP("unit", "u", "", "accept values with units (like 12ms or 1.2GiB), converted to this unit;\ntable and kv output use human-readable units")
+
+	timeCol    = flag.IntP("time", "t", 0, "1-based column of timestamps; report statistics for each time window")
+	timeFormat = flag.String("time-format", "auto", "format of timestamps: auto, rfc3339, unix (seconds) or unixms")
+	window     = flag.DurationP("window", "w", time.Minute, "with --time, length of windows")
+	step       = flag.Duration("step", 0, "with --time, interval between window starts for sliding windows (default --window)")
+
+	nBoot      = flag.Int("bootstrap", 1000, "compare: number of bootstrap resamples")
+	confidence = flag.Float64("confidence", 0.95, "compare: confidence level of intervals")
+	alpha      = flag.Float64("alpha", 0.05, "compare: significance level")
+	testName   = flag.String("test", "mwu", "compare: significance test, mwu (Mann-Whitney U) or welch (Welch's t-test)")
+)
+
+const desc = `
+qstats reads numbers from stdin and prints summary statistics.
+
+Input may be a table. Select the columns to summarize with -c and the
+columns to group rows by with -g. Separate columns by commas and give
+ranges using -. For example, 3-4,6 selects columns 3, 4, and 6.
+
+qstats compare reads two files of values, such as benchmark results from
+before and after a change, and reports how each statistic changed with a
+bootstrap confidence interval, along with the p-value of a test of whether
+the samples come from the same distribution.
+
+Besides the default statistics, -S accepts mad (median absolute
+deviation), outliers (the number of values beyond --fence), and
+trimmean and winsor, the means after dropping or clamping 10% of values
+at each end. Give another percentage like trimmean5.
+
+With -t, values are also grouped by time window, such as the minute in
+which they were recorded. Windows are fixed by default. Give --step
+shorter than --window for sliding windows that overlap. Windows with no
+values are shown when not grouping by key columns.`
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: qstats [options] < values")
+	fmt.Fprintln(os.Stderr, "       qstats [options] compare old new")
+	flag.PrintDefaults()
+	fmt.Fprintln(os.Stderr, desc)
+	os.Exit(2)
 }
 
 func main() {
 	log.SetPrefix("qstats: ")
 	log.SetFlags(0)
-	var all []float64
-	min := math.Inf(1)
-	max := math.Inf(-1)
-	prod := float64(1)
-	var count, total float64
-
-	s := bufio.NewScanner(os.Stdin)
-	for s.Scan() {
-		count++
-		v, err := strconv.ParseFloat(strings.TrimSpace(s.Text()), 64)
-		if err != nil {
-			log.Fatalf("stdin:%d: bad value: %v", err)
+	flag.Usage = usage
+	flag.Parse()
+	comparing := flag.NArg() == 3 && flag.Arg(0) == "compare"
+	if flag.NArg() != 0 && !comparing {
+		usage()
+	}
+	pcts, err := parsePcts(*pctList)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sl := *statList
+	if *timeCol > 0 && !flag.CommandLine.Changed("stats") {
+		sl = "count,pcts"
+	}
+	if *stream && !flag.CommandLine.Changed("stats") {
+		sl += ",rankerr"
+	}
+	stats, err := parseStats(sl, pcts, *fence)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, st := range stats {
+		if st.exact && *stream {
+			log.Fatalf("%s needs every value and is not available with --stream", st.name)
+		}
+	}
+	interp := quantileMethods[*method]
+	if interp == nil {
+		log.Fatalf("unknown percentile method %q", *method)
+	}
+	write := formats[*format]
+	if write == nil {
+		log.Fatalf("unknown output format %q", *format)
+	}
+	if *onBad != "fail" && *onBad != "skip" {
+		log.Fatalf("--on-bad must be fail or skip")
+	}
+	vf := valueFormat{precision: *precision, missing: "-"}
+	var u *unit
+	if *unitName != "" {
+		if u, err = lookupUnit(*unitName); err != nil {
+			log.Fatal(err)
 		}
-		total += v
-		prod *= v
-		all = append(all, v)
-		if v > max {
-			max = v
+		if *format == "table" || *format == "kv" {
+			vf.human = u
 		}
-		if v < min {
-			min = v
+	}
+	if *stream && *outliers {
+		log.Fatal("--outliers is not available with --stream")
+	}
+	if *stream && (*rankError <= 0 || *rankError >= 1) {
+		log.Fatal("rank error must be between 0 and 1")
+	}
+	cols, err := colsel.Parse(*colSelector)
+	if err != nil {
+		log.Fatalf("bad column selector: %v", err)
+	}
+	var keys []int
+	if *groupBy != "" {
+		if keys, err = colsel.Parse(*groupBy); err != nil {
+			log.Fatalf("bad group selector: %v", err)
 		}
 	}
+	var win *windowing
+	if *timeCol > 0 {
+		win = &windowing{col: *timeCol - 1, format: *timeFormat, size: *window, step: *step}
+		if win.step == 0 {
+			win.step = win.size
+		}
+		if !validTimeFormat(win.format) {
+			log.Fatalf("unknown time format %q", win.format)
+		}
+		if win.size <= 0 || win.step <= 0 {
+			log.Fatal("--window and --step must be positive")
+		}
+		for _, c := range append(cols, keys...) {
+			if c == win.col {
+				log.Fatal("time column cannot also be a value or key column")
+			}
+		}
+	}
+
+	newTable := func(name string) *table {
+		return &table{
+			name:      name,
+			delim:     *fieldDelim,
+			cols:      cols,
+			keys:      keys,
+			hasHeader: *hasHeader,
+			comment:   *comment,
+			skipBlank: *skipBlank,
+			skipBad:   *onBad == "skip",
+			unit:      u,
+			win:       win,
+			keepObs:   *outliers,
+			newSum: func() *summary {
+				if *stream {
+					return newSummary(newKLL(kllK(*rankError)), nil)
+				}
+				return newSummary(nil, interp)
+			},
+		}
+	}
+
+	if comparing {
+		if *stream || len(cols) != 1 || len(keys) != 0 || win != nil {
+			log.Fatal("compare needs exactly one column and no --stream, --group or --time")
+		}
+		c := &comparison{
+			stats:      stats,
+			interp:     interp,
+			nBoot:      *nBoot,
+			confidence: *confidence,
+			alpha:      *alpha,
+			vf:         vf,
+		}
+		if c.test = sigTests[*testName]; c.test == nil {
+			log.Fatalf("unknown test %q", *testName)
+		}
+		for i, name := range flag.Args()[1:] {
+			t := newTable(name)
+			if err := readFile(t, name); err != nil {
+				log.Fatal(err)
+			}
+			if len(t.rejects) > 0 {
+				log.Print(t.RejectSummary())
+			}
+			c.samples[i], _ = t.Single()
+		}
+		if err := c.write(os.Stdout, *format); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	sort.Float64s(all)
-	mean := total / count
-	var stddev float64
-	for _, v := range all {
-		x := v - mean
-		stddev += x * x
+	t := newTable("stdin")
+	if err := t.Read(os.Stdin); err != nil {
+		log.Fatal(err)
+	}
+	if len(t.rejects) > 0 {
+		log.Print(t.RejectSummary())
 	}
-	stddev /= float64(len(all)) - 1
-	stddev = math.Sqrt(stddev)
 
-	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
-	emit := func(name string, val float64) {
-		fmt.Fprintf(tw, "%s\t%v\n", name, val)
+	if *cdf || *hist {
+		sum, ok := t.Single()
+		if !ok || *stream {
+			log.Fatal("--cdf and --hist need exactly one column and no --stream, --group or --time")
+		}
+		if *cdf {
+			err = writeCDF(os.Stdout, sum.Values())
+		} else {
+			var h *histogram
+			if h, err = newHistogram(sum.Values(), *histBuckets, *histLog); err == nil {
+				err = h.Write(os.Stdout, *histWidth, vf)
+			}
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	emit("sum", total)
-	emit("min", min)
-	emit("pct25", getPercentile(all, 0.25))
-	emit("pct50", getPercentile(all, 0.5))
-	emit("pct75", getPercentile(all, 0.75))
-	emit("pct90", getPercentile(all, 0.9))
-	emit("pct95", getPercentile(all, 0.95))
-	emit("pct99", getPercentile(all, 0.99))
-	emit("max", max)
-	emit("geomean", math.Pow(prod, 1/count))
-	emit("mean", mean)
-	emit("stddev", stddev)
-	emit("count", count)
+	rep := &report{stats: stats, vf: vf}
+	if sum, ok := t.Single(); ok {
+		rep.single = true
+		rep.rows = []row{{sum: sum}}
+	} else {
+		rep.labelNames, rep.rows = t.Rows()
+	}
+	// Statistics of nothing would be a column of placeholders.
+	if len(rep.rows) == 0 || rep.single && rep.rows[0].sum.count == 0 {
+		log.Fatal("no values")
+	}
+	if *outliers {
+		if err := writeOutliers(os.Stdout, t, rep.rows, *fence, vf); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	for _, st := range stats {
+		if st.name != "geomean" {
+			continue
+		}
+		for _, r := range rep.rows {
+			if r.sum.nonPos > 0 {
+				where := ""
+				if !rep.single {
+					where = " for " + strings.Join(r.labels, " ")
+				}
+				log.Printf("geomean is undefined%s: %d values are not positive", where, r.sum.nonPos)
+			}
+		}
+	}
+	if err := write(rep, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
 
-	tw.Flush()
+func readFile(t *table, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return t.Read(f)
 }
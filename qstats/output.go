@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// A report holds the rows of output and knows how to format them.
+type report struct {
+	stats      []stat
+	labelNames []string
+	rows       []row
+	single     bool // one unlabeled summary
+	vf         valueFormat
+}
+
+// A valueFormat formats statistics for output.
+type valueFormat struct {
+	precision int    // digits after the decimal point, or -1 for as many as needed
+	human     *unit  // if non-nil, values are in this unit and printed with a suffix
+	missing   string // printed for undefined (NaN) values
+}
+
+// format formats v. If there is no set precision, sig limits the
+// number of significant digits unless it is -1.
+func (f valueFormat) format(st stat, v float64, sig int) string {
+	if math.IsNaN(v) {
+		return f.missing
+	}
+	if st.integral && !math.IsInf(v, 0) {
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	if f.human != nil && !st.unitless {
+		return f.human.human(v, f.precision)
+	}
+	if f.precision < 0 {
+		return strconv.FormatFloat(v, 'g', sig, 64)
+	}
+	return strconv.FormatFloat(v, 'f', f.precision, 64)
+}
+
+func (r *report) fmtVal(st stat, v float64) string {
+	return r.vf.format(st, v, -1)
+}
+
+// header returns the names of the output columns.
+func (r *report) header() []string {
+	var h []string
+	if !r.single {
+		h = append(h, r.labelNames...)
+	}
+	for _, st := range r.stats {
+		h = append(h, st.name)
+	}
+	return h
+}
+
+// records returns the formatted output rows.
+func (r *report) records() [][]string {
+	var recs [][]string
+	for _, row := range r.rows {
+		var rec []string
+		if !r.single {
+			rec = append(rec, row.labels...)
+		}
+		for _, st := range r.stats {
+			rec = append(rec, r.fmtVal(st, st.get(row.sum)))
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+var formats = map[string]func(*report, io.Writer) error{
+	"table": (*report).writeTable,
+	"tsv":   (*report).writeTSV,
+	"csv":   (*report).writeCSV,
+	"json":  (*report).writeJSON,
+	"kv":    (*report).writeKV,
+}
+
+// writeTable writes a single summary vertically, one statistic per line,
+// and several summaries as an aligned table.
+func (r *report) writeTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	if r.single {
+		rec := r.records()[0]
+		for i, st := range r.stats {
+			fmt.Fprintf(tw, "%s\t%s\n", st.name, rec[i])
+		}
+	} else {
+		fmt.Fprintln(tw, strings.Join(r.header(), "\t"))
+		for _, rec := range r.records() {
+			fmt.Fprintln(tw, strings.Join(rec, "\t"))
+		}
+	}
+	return tw.Flush()
+}
+
+func (r *report) writeTSV(w io.Writer) error {
+	r.vf.missing = ""
+	if _, err := fmt.Fprintln(w, strings.Join(r.header(), "\t")); err != nil {
+		return err
+	}
+	for _, rec := range r.records() {
+		if _, err := fmt.Fprintln(w, strings.Join(rec, "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *report) writeCSV(w io.Writer) error {
+	r.vf.missing = ""
+	cw := csv.NewWriter(w)
+	cw.Write(r.header())
+	cw.WriteAll(r.records())
+	return cw.Error()
+}
+
+// writeJSON writes an object for a single summary, or else an array of
+// objects. Values that JSON can't represent (NaN and infinities) are null.
+// Values are always plain numbers, without unit suffixes.
+func (r *report) writeJSON(w io.Writer) error {
+	r.vf.human = nil
+	var buf bytes.Buffer
+	if !r.single {
+		buf.WriteString("[")
+	}
+	for i, row := range r.rows {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		var names, vals []string
+		if !r.single {
+			for i, l := range row.labels {
+				names = append(names, r.labelNames[i])
+				vals = append(vals, jsonString(l))
+			}
+		}
+		for _, st := range r.stats {
+			names = append(names, st.name)
+			if v := st.get(row.sum); math.IsNaN(v) || math.IsInf(v, 0) {
+				vals = append(vals, "null")
+			} else {
+				vals = append(vals, r.fmtVal(st, v))
+			}
+		}
+		// Keys are written by hand to keep them in the order requested.
+		buf.WriteString("{")
+		for i := range names {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			buf.WriteString(jsonString(names[i]))
+			buf.WriteString(":")
+			buf.WriteString(vals[i])
+		}
+		buf.WriteString("}")
+	}
+	if !r.single {
+		buf.WriteString("]")
+	}
+	buf.WriteString("\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// writeKV writes each summary on a line of space-separated key=value pairs.
+func (r *report) writeKV(w io.Writer) error {
+	h := r.header()
+	for _, rec := range r.records() {
+		pairs := make([]string, len(rec))
+		for i := range rec {
+			pairs[i] = h[i] + "=" + kvQuote(rec[i])
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(pairs, " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func kvQuote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
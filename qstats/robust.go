@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Robust statistics resist the influence of a few extreme values.
+// They need every value, so they are NaN for summaries with a sketch.
+
+// TrimmedMean returns the mean of the values left after dropping
+// the fraction frac (< 0.5) of values from each end.
+func (s *summary) TrimmedMean(frac float64) float64 {
+	if s.sketch != nil {
+		return math.NaN()
+	}
+	vals := s.Values()
+	k := trimCount(len(vals), frac)
+	return meanOf(vals[k : len(vals)-k])
+}
+
+// WinsorizedMean returns the mean of the values after replacing the
+// fraction frac (< 0.5) of values at each end by the nearest value kept.
+func (s *summary) WinsorizedMean(frac float64) float64 {
+	if s.sketch != nil || s.count == 0 {
+		return math.NaN()
+	}
+	vals := s.Values()
+	n := len(vals)
+	k := trimCount(n, frac)
+	w := make([]float64, n)
+	for i := range w {
+		switch {
+		case i < k:
+			w[i] = vals[k]
+		case i >= n-k:
+			w[i] = vals[n-k-1]
+		default:
+			w[i] = vals[i]
+		}
+	}
+	return meanOf(w)
+}
+
+func trimCount(n int, frac float64) int {
+	return int(math.Floor(frac * float64(n)))
+}
+
+// meanOf returns the mean of vals, summing the finite ones separately
+// so that an infinite value doesn't make the sum NaN.
+func meanOf(vals []float64) float64 {
+	if len(vals) == 0 {
+		return math.NaN()
+	}
+	var (
+		sum kahanSum
+		inf float64
+	)
+	for _, v := range vals {
+		if math.IsInf(v, 0) {
+			inf += v
+		} else {
+			sum.Add(v)
+		}
+	}
+	return sum.Value()/float64(len(vals)) + inf
+}
+
+// MAD returns the median absolute deviation from the median, unscaled.
+// Multiply by 1.4826 to estimate the standard deviation of normal data.
+func (s *summary) MAD() float64 {
+	if s.sketch != nil {
+		return math.NaN()
+	}
+	vals := s.Values()
+	med := s.interp(vals, 0.5)
+	devs := make([]float64, len(vals))
+	for i, v := range vals {
+		devs[i] = math.Abs(v - med)
+	}
+	sort.Float64s(devs)
+	return s.interp(devs, 0.5)
+}
+
+// Fences returns Tukey's fences: values below lo or above hi are
+// outliers. They are k interquartile ranges beyond the quartiles;
+// k is conventionally 1.5.
+func (s *summary) Fences(k float64) (lo, hi float64) {
+	q1, q3 := s.Quantile(0.25), s.Quantile(0.75)
+	iqr := q3 - q1
+	return q1 - k*iqr, q3 + k*iqr
+}
+
+// Outliers returns the number of values outside Fences(k).
+func (s *summary) Outliers(k float64) float64 {
+	if s.sketch != nil {
+		return math.NaN()
+	}
+	if s.count == 0 {
+		return 0
+	}
+	vals := s.Values()
+	lo, hi := s.Fences(k)
+	below := sort.SearchFloat64s(vals, lo)
+	above := len(vals) - sort.Search(len(vals), func(i int) bool { return vals[i] > hi })
+	return float64(below + above)
+}
+
+// writeOutliers prints the values of each row outside Fences(k), one
+// per line, with where they were read and the labels of the row.
+func writeOutliers(w io.Writer, t *table, rows []row, k float64, vf valueFormat) error {
+	bw := bufio.NewWriter(w)
+	for _, r := range rows {
+		lo, hi := r.sum.Fences(k)
+		for _, o := range t.obs[r.sum] {
+			if o.v >= lo && o.v <= hi {
+				continue
+			}
+			fields := append([]string{fmt.Sprintf("%s:%d", t.name, o.line)}, r.labels...)
+			fields = append(fields, vf.format(stat{}, o.v, -1))
+			fmt.Fprintln(bw, strings.Join(fields, "\t"))
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// A kll is a KLL quantile sketch (Karnin, Lang and Liberty, "Optimal
+// Quantile Approximation in Streams", FOCS 2016). It keeps O(k log(n/k))
+// values no matter how many are added, and two sketches can be merged.
+//
+// Values are held in levels of compactors. Each value in level h stands
+// for 2^h input values. When a level fills up, it is sorted and every
+// other value is promoted to the next level.
+type kll struct {
+	k         int
+	levels    [][]float64
+	size      int   // values held in all levels
+	n         int64 // values added
+	compacted bool  // false while the sketch is still exact
+	rng       *rand.Rand
+}
+
+// kllK returns the k that gives a normalized rank error of about eps
+// with 99% confidence.
+func kllK(eps float64) int {
+	k := int(math.Ceil(math.Pow(2.296/eps, 1/0.9723)))
+	if k < 8 {
+		k = 8
+	}
+	return k
+}
+
+func newKLL(k int) *kll {
+	return &kll{
+		k:      k,
+		levels: make([][]float64, 1),
+		// A fixed seed keeps results reproducible from run to run.
+		rng: rand.New(rand.NewSource(1)),
+	}
+}
+
+// RankError returns the normalized rank error of quantiles from s,
+// with 99% confidence. The constants are those used by Apache DataSketches.
+func (s *kll) RankError() float64 {
+	if !s.compacted {
+		return 0
+	}
+	return 2.296 / math.Pow(float64(s.k), 0.9723)
+}
+
+func (s *kll) capacity(h int) int {
+	depth := len(s.levels) - h - 1
+	c := int(math.Ceil(float64(s.k) * math.Pow(2.0/3, float64(depth))))
+	if c < 2 {
+		c = 2
+	}
+	return c
+}
+
+func (s *kll) maxSize() int {
+	var m int
+	for h := range s.levels {
+		m += s.capacity(h)
+	}
+	return m
+}
+
+func (s *kll) Add(v float64) {
+	s.levels[0] = append(s.levels[0], v)
+	s.size++
+	s.n++
+	s.compress()
+}
+
+// Merge adds the values summarized by o to s.
+func (s *kll) Merge(o *kll) {
+	for len(s.levels) < len(o.levels) {
+		s.levels = append(s.levels, nil)
+	}
+	for h, l := range o.levels {
+		s.levels[h] = append(s.levels[h], l...)
+		s.size += len(l)
+	}
+	s.n += o.n
+	s.compacted = s.compacted || o.compacted
+	s.compress()
+}
+
+func (s *kll) compress() {
+	for s.size >= s.maxSize() {
+		for h := range s.levels {
+			if len(s.levels[h]) < s.capacity(h) {
+				continue
+			}
+			if h+1 == len(s.levels) {
+				s.levels = append(s.levels, nil)
+			}
+			l := s.levels[h]
+			sort.Float64s(l)
+			// With an odd count, the largest value stays behind.
+			var keep []float64
+			if len(l)%2 == 1 {
+				keep = l[len(l)-1:]
+				l = l[:len(l)-1]
+			}
+			for i := s.rng.Intn(2); i < len(l); i += 2 {
+				s.levels[h+1] = append(s.levels[h+1], l[i])
+			}
+			s.size -= len(l) / 2
+			s.levels[h] = append(s.levels[h][:0], keep...)
+			s.compacted = true
+			break
+		}
+	}
+}
+
+// Quantile returns an estimate of the p-quantile (0 <= p <= 1).
+func (s *kll) Quantile(p float64) float64 {
+	if s.n == 0 {
+		return math.NaN()
+	}
+	type wv struct {
+		v float64
+		w int64
+	}
+	var all []wv
+	for h, l := range s.levels {
+		for _, v := range l {
+			all = append(all, wv{v, 1 << uint(h)})
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+	var total int64
+	for _, x := range all {
+		total += x.w
+	}
+	target := p * float64(total)
+	var cum int64
+	for _, x := range all {
+		cum += x.w
+		if float64(cum) >= target {
+			return x.v
+		}
+	}
+	return all[len(all)-1].v
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type stat struct {
+	name     string
+	get      func(*summary) float64
+	integral bool // always formatted without a fractional part
+	unitless bool // doesn't share the unit of the input values
+	exact    bool // needs every value, so not available with --stream
+}
+
+// statFuncs holds the statistics that can be named in --stats,
+// apart from percentiles which are named like pct99.9.
+var statFuncs = map[string]func(*summary) float64{
+	"sum":     (*summary).Sum,
+	"min":     (*summary).Min,
+	"max":     (*summary).Max,
+	"geomean": (*summary).Geomean,
+	"mean":    (*summary).Mean,
+	"stddev":  (*summary).Stddev,
+	"count":   (*summary).Count,
+	"rankerr": (*summary).RankError,
+	"mad":     (*summary).MAD,
+}
+
+const defaultStats = "sum,min,pcts,max,geomean,mean,stddev,count"
+
+// defaultTrim is the percentage trimmed from each end by
+// trimmean and winsor when none is given.
+const defaultTrim = 10
+
+// parseStats parses a comma-separated list of statistic names.
+// The name pcts stands for every percentile in pcts. Outliers are
+// counted fence interquartile ranges beyond the quartiles.
+func parseStats(list string, pcts []float64, fence float64) ([]stat, error) {
+	var stats []stat
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "pcts":
+			for _, p := range pcts {
+				stats = append(stats, pctStat(p))
+			}
+		case strings.HasPrefix(name, "pct"):
+			p, err := parsePct(name[len("pct"):])
+			if err != nil {
+				return nil, err
+			}
+			stats = append(stats, pctStat(p))
+		case strings.HasPrefix(name, "trimmean"), strings.HasPrefix(name, "winsor"):
+			st, err := trimStat(name)
+			if err != nil {
+				return nil, err
+			}
+			stats = append(stats, st)
+		case name == "outliers":
+			stats = append(stats, stat{
+				name:     name,
+				get:      func(s *summary) float64 { return s.Outliers(fence) },
+				integral: true,
+				unitless: true,
+				exact:    true,
+			})
+		case statFuncs[name] != nil:
+			stats = append(stats, stat{
+				name:     name,
+				get:      statFuncs[name],
+				integral: name == "count",
+				unitless: name == "count" || name == "rankerr",
+				exact:    name == "mad",
+			})
+		default:
+			return nil, fmt.Errorf("unknown statistic %q", name)
+		}
+	}
+	return stats, nil
+}
+
+// parsePcts parses a comma-separated list of percentiles.
+func parsePcts(list string) ([]float64, error) {
+	var pcts []float64
+	for _, f := range strings.Split(list, ",") {
+		p, err := parsePct(strings.TrimSpace(f))
+		if err != nil {
+			return nil, err
+		}
+		pcts = append(pcts, p)
+	}
+	return pcts, nil
+}
+
+func parsePct(s string) (float64, error) {
+	p, err := strconv.ParseFloat(s, 64)
+	if err != nil || p < 0 || p > 100 {
+		return 0, fmt.Errorf("bad percentile %q", s)
+	}
+	return p, nil
+}
+
+func pctStat(p float64) stat {
+	return stat{
+		name: "pct" + strconv.FormatFloat(p, 'f', -1, 64),
+		get:  func(s *summary) float64 { return s.Quantile(p / 100) },
+	}
+}
+
+// trimStat returns the trimmed or winsorized mean named like trimmean5
+// or winsor5, which replace 5% of values at each end.
+func trimStat(name string) (stat, error) {
+	kind, mean := "trimmean", (*summary).TrimmedMean
+	if strings.HasPrefix(name, "winsor") {
+		kind, mean = "winsor", (*summary).WinsorizedMean
+	}
+	p := float64(defaultTrim)
+	if s := name[len(kind):]; s != "" {
+		var err error
+		if p, err = strconv.ParseFloat(s, 64); err != nil || p < 0 || p >= 50 {
+			return stat{}, fmt.Errorf("bad trim percentage in %q", name)
+		}
+	}
+	return stat{
+		name:  kind + strconv.FormatFloat(p, 'f', -1, 64),
+		get:   func(s *summary) float64 { return mean(s, p/100) },
+		exact: true,
+	}, nil
+}
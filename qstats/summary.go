@@ -0,0 +1,250 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// A summary accumulates the statistics that qstats reports.
+// Counts, sums, extremes and moments are always exact. Quantiles are
+// exact unless the summary was created with a sketch, in which case
+// memory use stays bounded.
+//
+// Statistics that are undefined, like the mean of no values, are NaN.
+// Values must not be NaN, but may be infinite.
+type summary struct {
+	count    float64
+	min, max float64
+	sum      kahanSum // of finite values
+	// The geomean is computed from log2 of the positive values, split
+	// into exponents, summed exactly, and logs of mantissas.
+	expSum  int64
+	mantLog kahanSum
+	nonPos  int // values <= 0, for which the geomean is undefined
+	posInf  int
+	negInf  int
+
+	// Running mean and sum of squared deviations of finite values,
+	// using Welford's algorithm.
+	nFinite  float64
+	mean, m2 float64
+
+	all    []float64 // every value, if exact
+	sorted bool
+	interp quantileFunc
+	sketch *kll
+}
+
+// newSummary returns an empty summary. If sketch is nil, every value is
+// kept and quantiles are computed using interp.
+func newSummary(sketch *kll, interp quantileFunc) *summary {
+	return &summary{
+		min:    math.Inf(1),
+		max:    math.Inf(-1),
+		interp: interp,
+		sketch: sketch,
+	}
+}
+
+func (s *summary) Add(v float64) {
+	s.count++
+	if v > s.max {
+		s.max = v
+	}
+	if v < s.min {
+		s.min = v
+	}
+	if v > 0 && !math.IsInf(v, 1) {
+		m, e := math.Frexp(v)
+		s.expSum += int64(e)
+		s.mantLog.Add(math.Log2(m))
+	} else if v <= 0 {
+		s.nonPos++
+	}
+	switch {
+	case math.IsInf(v, 1):
+		s.posInf++
+	case math.IsInf(v, -1):
+		s.negInf++
+	default:
+		s.sum.Add(v)
+		s.nFinite++
+		// Divide before subtracting so that the step doesn't
+		// overflow for values near the largest float.
+		step := v/s.nFinite - s.mean/s.nFinite
+		s.mean += step
+		s.m2 += s.nFinite * step * (v - s.mean)
+	}
+
+	if s.sketch != nil {
+		s.sketch.Add(v)
+	} else {
+		s.all = append(s.all, v)
+		s.sorted = false
+	}
+}
+
+func (s *summary) Count() float64 { return s.count }
+
+func (s *summary) Min() float64 {
+	if s.count == 0 {
+		return math.NaN()
+	}
+	return s.min
+}
+
+func (s *summary) Max() float64 {
+	if s.count == 0 {
+		return math.NaN()
+	}
+	return s.max
+}
+
+// inf returns the infinity that the infinite values add up to, or 0 if
+// there are none, or NaN if they cancel.
+func (s *summary) inf() float64 {
+	switch {
+	case s.posInf > 0 && s.negInf > 0:
+		return math.NaN()
+	case s.posInf > 0:
+		return math.Inf(1)
+	case s.negInf > 0:
+		return math.Inf(-1)
+	}
+	return 0
+}
+
+func (s *summary) Sum() float64 {
+	return s.sum.Value() + s.inf()
+}
+
+func (s *summary) Mean() float64 {
+	if s.count == 0 {
+		return math.NaN()
+	}
+	return s.mean + s.inf()
+}
+
+// Stddev returns the sample standard deviation. It is undefined for
+// fewer than two values or if any value is infinite.
+func (s *summary) Stddev() float64 {
+	if s.count < 2 || s.posInf+s.negInf > 0 {
+		return math.NaN()
+	}
+	return math.Sqrt(s.m2 / (s.count - 1))
+}
+
+// Geomean returns the geometric mean, computed from the mean of logs so
+// that it neither overflows nor underflows. It is only defined if every
+// value is positive.
+func (s *summary) Geomean() float64 {
+	if s.count == 0 || s.nonPos > 0 {
+		return math.NaN()
+	}
+	if s.posInf > 0 {
+		return math.Inf(1)
+	}
+	e := float64(s.expSum) / s.count
+	whole := math.Floor(e)
+	return math.Ldexp(math.Exp2(e-whole+s.mantLog.Value()/s.count), int(whole))
+}
+
+// A kahanSum adds floats using Neumaier's variant of Kahan summation,
+// which keeps the rounding error from growing with the number of terms.
+type kahanSum struct {
+	sum, c float64
+}
+
+func (k *kahanSum) Add(v float64) {
+	t := k.sum + v
+	if math.IsInf(t, 0) {
+		// The sum overflowed, and compensating would make it NaN.
+		k.sum = t
+		return
+	}
+	if math.Abs(k.sum) >= math.Abs(v) {
+		k.c += (k.sum - t) + v
+	} else {
+		k.c += (v - t) + k.sum
+	}
+	k.sum = t
+}
+
+func (k *kahanSum) Value() float64 {
+	return k.sum + k.c
+}
+
+// Values returns the sorted values of an exact summary.
+func (s *summary) Values() []float64 {
+	if !s.sorted {
+		sort.Float64s(s.all)
+		s.sorted = true
+	}
+	return s.all
+}
+
+// Quantile returns the p-quantile (0 <= p <= 1).
+func (s *summary) Quantile(p float64) float64 {
+	if s.sketch != nil {
+		return s.sketch.Quantile(p)
+	}
+	return s.interp(s.Values(), p)
+}
+
+// RankError returns the normalized rank error of quantiles.
+func (s *summary) RankError() float64 {
+	if s.sketch == nil {
+		return 0
+	}
+	return s.sketch.RankError()
+}
+
+// A quantileFunc returns the p-quantile of the sorted values.
+type quantileFunc func(vals []float64, p float64) float64
+
+// quantileMethods are the ways of estimating quantiles from a sample.
+// See Hyndman and Fan, "Sample Quantiles in Statistical Packages", 1996.
+var quantileMethods = map[string]quantileFunc{
+	"linear":       getPercentile,
+	"type7":        getPercentile, // R's default, same as linear
+	"nearest":      nearestIndex,
+	"nearest-rank": nearestRank,
+	"type1":        nearestRank, // inverse of the empirical CDF
+}
+
+// getPercentile interpolates linearly between the closest ranks.
+func getPercentile(vals []float64, pct float64) float64 {
+	if len(vals) == 0 {
+		return math.NaN()
+	}
+	k := float64(len(vals)-1) * pct
+	f := math.Floor(k)
+	c := math.Ceil(k)
+	if f == c {
+		return vals[int(k)]
+	}
+	d0 := vals[int(f)] * (c - k)
+	d1 := vals[int(c)] * (k - f)
+	return d0 + d1
+}
+
+// nearestIndex rounds the linearly interpolated rank to the nearest value.
+func nearestIndex(vals []float64, pct float64) float64 {
+	if len(vals) == 0 {
+		return math.NaN()
+	}
+	return vals[int(math.Round(float64(len(vals)-1)*pct))]
+}
+
+// nearestRank returns the smallest value such that at least pct of the
+// values are no greater than it.
+func nearestRank(vals []float64, pct float64) float64 {
+	if len(vals) == 0 {
+		return math.NaN()
+	}
+	i := int(math.Ceil(float64(len(vals))*pct)) - 1
+	if i < 0 {
+		i = 0
+	}
+	return vals[i]
+}
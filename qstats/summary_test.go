@@ -0,0 +1,213 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func summarize(vals ...float64) *summary {
+	s := newSummary(nil, getPercentile)
+	for _, v := range vals {
+		s.Add(v)
+	}
+	return s
+}
+
+func near(got, want float64) bool {
+	if math.IsNaN(want) {
+		return math.IsNaN(got)
+	}
+	if math.IsInf(want, 0) {
+		return got == want
+	}
+	return math.Abs(got-want) <= 1e-12*math.Max(1, math.Abs(want))
+}
+
+func TestSummaryStats(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+	tests := []struct {
+		name string
+		vals []float64
+		stat string
+		want float64
+	}{
+		{"EmptyCount", nil, "count", 0},
+		{"EmptySum", nil, "sum", 0},
+		{"EmptyMin", nil, "min", nan},
+		{"EmptyMax", nil, "max", nan},
+		{"EmptyMean", nil, "mean", nan},
+		{"EmptyStddev", nil, "stddev", nan},
+		{"EmptyGeomean", nil, "geomean", nan},
+
+		{"OneMean", []float64{5}, "mean", 5},
+		{"OneStddev", []float64{5}, "stddev", nan},
+		{"OneGeomean", []float64{5}, "geomean", 5},
+		{"TwoStddev", []float64{1, 3}, "stddev", math.Sqrt2},
+
+		{"GeomeanSmall", []float64{1, 2, 4, 8}, "geomean", math.Sqrt(8)},
+		{"GeomeanOverflow", []float64{1e300, 1e300, 1e300}, "geomean", 1e300},
+		{"GeomeanUnderflow", []float64{1e-300, 1e-300}, "geomean", 1e-300},
+		{"GeomeanZero", []float64{0, 1, 2}, "geomean", nan},
+		{"GeomeanNegative", []float64{-1, 1, 2}, "geomean", nan},
+
+		{"InfSum", []float64{1, inf}, "sum", inf},
+		{"InfMean", []float64{1, inf}, "mean", inf},
+		{"InfStddev", []float64{1, inf}, "stddev", nan},
+		{"InfMax", []float64{1, inf}, "max", inf},
+		{"InfMin", []float64{1, -inf}, "min", -inf},
+		{"SumOverflow", []float64{1e308, 1e308}, "sum", inf},
+		{"MeanNearMax", []float64{1e308, 1e308, -1e308}, "mean", 1e308 / 3},
+		{"InfsCancel", []float64{inf, -inf}, "mean", nan},
+		{"InfGeomean", []float64{1, inf}, "geomean", inf},
+
+		// Naive summation would lose every 1 to the large terms.
+		{"KahanSum", []float64{1e16, 1, 1, 1, 1, -1e16}, "sum", 4},
+		{"LargeOffsetStddev", []float64{1e9 + 4, 1e9 + 7, 1e9 + 13, 1e9 + 16}, "stddev", math.Sqrt(30)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := statFuncs[test.stat](summarize(test.vals...))
+			if !near(got, test.want) {
+				t.Errorf("%s of %v = %v, want %v", test.stat, test.vals, got, test.want)
+			}
+		})
+	}
+}
+
+func TestQuantileMethods(t *testing.T) {
+	vals := []float64{1, 2, 3, 4}
+	tests := []struct {
+		method string
+		p      float64
+		want   float64
+	}{
+		{"linear", 0.5, 2.5},
+		{"linear", 0.9, 3.7},
+		{"linear", 0, 1},
+		{"linear", 1, 4},
+		{"type7", 0.25, 1.75},
+		{"nearest", 0.5, 3}, // 1.5 rounds away from zero
+		{"nearest", 0.1, 1},
+		{"nearest-rank", 0.5, 2},
+		{"nearest-rank", 0.51, 3},
+		{"nearest-rank", 0, 1},
+		{"type1", 1, 4},
+	}
+	for _, test := range tests {
+		if got := quantileMethods[test.method](vals, test.p); !near(got, test.want) {
+			t.Errorf("%s(%v, %v) = %v, want %v", test.method, vals, test.p, got, test.want)
+		}
+	}
+	for name, f := range quantileMethods {
+		if got := f(nil, 0.5); !math.IsNaN(got) {
+			t.Errorf("%s of no values = %v, want NaN", name, got)
+		}
+	}
+}
+
+func TestKLLAccuracy(t *testing.T) {
+	const n = 200000
+	eps := 0.01
+	s := newKLL(kllK(eps))
+	for i := 0; i < n; i++ {
+		// A permutation of 0..n-1, so the true rank of v is v/n.
+		s.Add(float64((i * 7919) % n))
+	}
+	if s.RankError() > eps {
+		t.Errorf("RankError() = %v, want <= %v", s.RankError(), eps)
+	}
+	for _, p := range []float64{0.01, 0.25, 0.5, 0.9, 0.99} {
+		rank := s.Quantile(p) / n
+		if math.Abs(rank-p) > eps {
+			t.Errorf("Quantile(%v) has rank %v, want within %v", p, rank, eps)
+		}
+	}
+}
+
+func TestKLLMerge(t *testing.T) {
+	const n = 200000
+	eps := 0.01
+	// Sketch the lower and upper halves of 0..n-1 separately, each in a
+	// shuffled order, then merge them.
+	a, b := newKLL(kllK(eps)), newKLL(kllK(eps))
+	for i := 0; i < n/2; i++ {
+		v := float64((i * 7919) % (n / 2))
+		a.Add(v)
+		b.Add(v + n/2)
+	}
+	a.Merge(b)
+	if a.n != n {
+		t.Errorf("merged sketch has %d values, want %d", a.n, n)
+	}
+	if a.RankError() > eps {
+		t.Errorf("RankError() = %v, want <= %v", a.RankError(), eps)
+	}
+	for _, p := range []float64{0.01, 0.25, 0.49, 0.5, 0.51, 0.9, 0.99} {
+		rank := a.Quantile(p) / n
+		if math.Abs(rank-p) > a.RankError() {
+			t.Errorf("Quantile(%v) has rank %v, want within %v", p, rank, a.RankError())
+		}
+	}
+}
+
+func TestReadRejectsNaN(t *testing.T) {
+	newTable := func(skip bool) *table {
+		return &table{
+			name:    "test",
+			cols:    []int{0},
+			skipBad: skip,
+			newSum:  func() *summary { return newSummary(nil, getPercentile) },
+		}
+	}
+	in := "1\nNaN\n+Inf\n2\n"
+
+	if err := newTable(false).Read(strings.NewReader(in)); err == nil || !strings.Contains(err.Error(), "test:2:") {
+		t.Errorf("Read = %v, want error on line 2", err)
+	}
+
+	tab := newTable(true)
+	if err := tab.Read(strings.NewReader(in)); err != nil {
+		t.Fatal(err)
+	}
+	sum, _ := tab.Single()
+	if sum.Count() != 3 || !math.IsInf(sum.Max(), 1) {
+		t.Errorf("got count %v max %v, want 3 and +Inf", sum.Count(), sum.Max())
+	}
+	if len(tab.rejects) != 1 || tab.rejects[0] != 2 {
+		t.Errorf("rejects = %v, want [2]", tab.rejects)
+	}
+}
+
+func TestRobustStats(t *testing.T) {
+	vals := []float64{-300, 1, 2, 3, 4, 5, 6, 7, 8, 9, 5000}
+	stats, err := parseStats("trimmean,trimmean0,winsor10,mad,outliers", nil, 1.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{5, (-300 + 45 + 5000) / 11.0, 5, 3, 2}
+	s := summarize(vals...)
+	for i, st := range stats {
+		if got := st.get(s); !near(got, want[i]) {
+			t.Errorf("%s = %v, want %v", st.name, got, want[i])
+		}
+	}
+
+	empty := summarize()
+	for _, st := range stats {
+		got := st.get(empty)
+		if st.name == "outliers" {
+			if got != 0 {
+				t.Errorf("%s of no values = %v, want 0", st.name, got)
+			}
+		} else if !math.IsNaN(got) {
+			t.Errorf("%s of no values = %v, want NaN", st.name, got)
+		}
+	}
+
+	for _, name := range []string{"trimmean50", "winsor-1", "trimmeanx"} {
+		if _, err := parseStats(name, nil, 1.5); err == nil {
+			t.Errorf("parseStats(%q) succeeded", name)
+		}
+	}
+}
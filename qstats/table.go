@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A table accumulates a summary for every selected column of every group.
+type table struct {
+	name      string // input name for error messages
+	delim     string // "" splits on whitespace
+	cols      []int  // 0-based value columns
+	keys      []int  // 0-based group key columns
+	hasHeader bool
+	newSum    func() *summary
+
+	comment   string // skip lines starting with comment, if not empty
+	skipBlank bool   // skip empty lines
+	skipBad   bool   // skip lines with bad values instead of failing
+	unit      *unit  // if non-nil, values may have unit suffixes
+	rejects   []int  // numbers of skipped bad lines
+
+	win *windowing // if non-nil, rows are also grouped by time window
+
+	keepObs bool // record where each value came from in obs
+	obs     map[*summary][]obs
+
+	header []string
+	groups []string // group keys in order of first appearance
+	sums   map[string][]*summary
+}
+
+// groupSep joins the key fields of a group. It can't appear in a field.
+const groupSep = "\n"
+
+func (t *table) Read(r io.Reader) error {
+	t.sums = make(map[string][]*summary)
+	t.obs = make(map[*summary][]obs)
+	s := bufio.NewScanner(r)
+	var (
+		sawHeader bool
+		vals      = make([]float64, len(t.cols))
+	)
+	for lineno := 1; s.Scan(); lineno++ {
+		line := s.Text()
+		if t.skipBlank && strings.TrimSpace(line) == "" {
+			continue
+		}
+		if t.comment != "" && strings.HasPrefix(strings.TrimSpace(line), t.comment) {
+			continue
+		}
+		var fs []string
+		if t.delim == "" {
+			fs = strings.Fields(line)
+		} else {
+			fs = strings.Split(line, t.delim)
+		}
+		if t.hasHeader && !sawHeader {
+			sawHeader = true
+			t.header = fs
+			continue
+		}
+
+		err := t.parseRow(fs, vals)
+		var first, last int64
+		if err == nil && t.win != nil {
+			first, last, err = t.rowWindows(fs)
+		}
+		if err != nil && t.skipBad {
+			t.rejects = append(t.rejects, lineno)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("%s:%d: %v", t.name, lineno, err)
+		}
+
+		kfs := make([]string, len(t.keys))
+		for i, k := range t.keys {
+			kfs[i] = fs[k]
+		}
+		if t.win == nil {
+			t.add(strings.Join(kfs, groupSep), vals, lineno)
+			continue
+		}
+		for k := first; k <= last; k++ {
+			t.add(strings.Join(append([]string{strconv.FormatInt(k, 10)}, kfs...), groupSep), vals, lineno)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	if t.win != nil {
+		t.sortWindows()
+	}
+	return nil
+}
+
+// An obs is a value and the line it was read from.
+type obs struct {
+	line int
+	v    float64
+}
+
+// add adds vals, read from line lineno, to the summaries of group g.
+func (t *table) add(g string, vals []float64, lineno int) {
+	sums, ok := t.sums[g]
+	if !ok {
+		sums = t.newSums()
+		t.sums[g] = sums
+		t.groups = append(t.groups, g)
+	}
+	for i, v := range vals {
+		sums[i].Add(v)
+		if t.keepObs {
+			t.obs[sums[i]] = append(t.obs[sums[i]], obs{lineno, v})
+		}
+	}
+}
+
+func (t *table) newSums() []*summary {
+	sums := make([]*summary, len(t.cols))
+	for i := range sums {
+		sums[i] = t.newSum()
+	}
+	return sums
+}
+
+// rowWindows returns the range of windows that the row fs falls in.
+func (t *table) rowWindows(fs []string) (first, last int64, err error) {
+	if t.win.col >= len(fs) {
+		return 0, 0, fmt.Errorf("missing time column %d", t.win.col+1)
+	}
+	ts, err := t.win.parseTime(strings.TrimSpace(fs[t.win.col]))
+	if err != nil {
+		return 0, 0, err
+	}
+	if t.win.loc == nil {
+		t.win.loc = ts.Location()
+	}
+	first, last = t.win.windows(ts)
+	return first, last, nil
+}
+
+// windowOf returns the window of group g.
+func windowOf(g string) int64 {
+	k, _ := strconv.ParseInt(strings.SplitN(g, groupSep, 2)[0], 10, 64)
+	return k
+}
+
+// maxGapFill limits how many windows sortWindows will fill in.
+const maxGapFill = 100000
+
+// sortWindows puts groups in time order. Without key columns,
+// empty windows are added to fill gaps so that they stand out.
+func (t *table) sortWindows() {
+	sort.SliceStable(t.groups, func(i, j int) bool {
+		return windowOf(t.groups[i]) < windowOf(t.groups[j])
+	})
+	if len(t.keys) > 0 || len(t.groups) == 0 {
+		return
+	}
+	first, last := windowOf(t.groups[0]), windowOf(t.groups[len(t.groups)-1])
+	if last-first >= maxGapFill {
+		return
+	}
+	t.groups = t.groups[:0]
+	for k := first; k <= last; k++ {
+		g := strconv.FormatInt(k, 10)
+		if t.sums[g] == nil {
+			t.sums[g] = t.newSums()
+		}
+		t.groups = append(t.groups, g)
+	}
+}
+
+// parseRow parses the selected columns of fs into vals.
+// A row is only used if all of them are good.
+func (t *table) parseRow(fs []string, vals []float64) error {
+	for _, k := range t.keys {
+		if k >= len(fs) {
+			return fmt.Errorf("missing key column %d", k+1)
+		}
+	}
+	for i, c := range t.cols {
+		if c >= len(fs) {
+			return fmt.Errorf("missing column %d", c+1)
+		}
+		f := strings.TrimSpace(fs[c])
+		var err error
+		if t.unit != nil {
+			vals[i], err = t.unit.parse(f)
+		} else {
+			vals[i], err = strconv.ParseFloat(f, 64)
+		}
+		if err != nil {
+			return fmt.Errorf("bad value: %v", err)
+		}
+		if math.IsNaN(vals[i]) {
+			return fmt.Errorf("bad value: %s is not a number", f)
+		}
+	}
+	return nil
+}
+
+// RejectSummary describes the lines that were skipped for having bad values.
+func (t *table) RejectSummary() string {
+	const maxList = 20
+	var lines []string
+	for i, n := range t.rejects {
+		if i == maxList {
+			lines = append(lines, fmt.Sprintf("and %d more", len(t.rejects)-maxList))
+			break
+		}
+		lines = append(lines, strconv.Itoa(n))
+	}
+	return fmt.Sprintf("%s: skipped %d bad lines: %s", t.name, len(t.rejects), strings.Join(lines, ", "))
+}
+
+// colName returns the name of the 0-based column c.
+func (t *table) colName(c int) string {
+	if c < len(t.header) {
+		return t.header[c]
+	}
+	return "col" + strconv.Itoa(c+1)
+}
+
+// Single returns the only summary if there is one column and no grouping.
+func (t *table) Single() (*summary, bool) {
+	if len(t.keys) != 0 || len(t.cols) != 1 || t.win != nil {
+		return nil, false
+	}
+	if len(t.groups) == 0 {
+		return t.newSum(), true
+	}
+	return t.sums[t.groups[0]][0], true
+}
+
+// A row is one summary in the output with the names that identify it.
+type row struct {
+	labels []string // group keys followed by the column name
+	sum    *summary
+}
+
+func (t *table) Rows() (labelNames []string, rows []row) {
+	if t.win != nil {
+		labelNames = append(labelNames, "window")
+	}
+	for _, k := range t.keys {
+		labelNames = append(labelNames, t.colName(k))
+	}
+	labelNames = append(labelNames, "column")
+	for _, g := range t.groups {
+		var kfs []string
+		if len(t.keys) > 0 || t.win != nil {
+			kfs = strings.Split(g, groupSep)
+		}
+		if t.win != nil {
+			kfs[0] = t.win.label(windowOf(g))
+		}
+		for i, c := range t.cols {
+			labels := append(kfs[:len(kfs):len(kfs)], t.colName(c))
+			rows = append(rows, row{labels, t.sums[g][i]})
+		}
+	}
+	return labelNames, rows
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A unit is a unit of measure that values may carry, like ms or GiB.
+type unit struct {
+	name  string
+	dim   string  // "time", "bytes", or "" for plain multipliers
+	scale float64 // size in the dimension's smallest named unit (seconds or bytes)
+}
+
+var units = map[string]unit{}
+
+func init() {
+	for _, u := range []unit{
+		{"ns", "time", 1e-9},
+		{"us", "time", 1e-6},
+		{"µs", "time", 1e-6}, // micro sign
+		{"μs", "time", 1e-6}, // Greek mu
+		{"ms", "time", 1e-3},
+		{"s", "time", 1},
+		{"m", "time", 60}, // as in Go durations
+		{"min", "time", 60},
+		{"h", "time", 3600},
+
+		{"B", "bytes", 1},
+		{"kB", "bytes", 1e3},
+		{"KB", "bytes", 1e3},
+		{"MB", "bytes", 1e6},
+		{"GB", "bytes", 1e9},
+		{"TB", "bytes", 1e12},
+		{"PB", "bytes", 1e15},
+		{"KiB", "bytes", 1 << 10},
+		{"MiB", "bytes", 1 << 20},
+		{"GiB", "bytes", 1 << 30},
+		{"TiB", "bytes", 1 << 40},
+		{"PiB", "bytes", 1 << 50},
+
+		{"1", "", 1},
+		{"k", "", 1e3},
+		{"K", "", 1e3},
+		{"M", "", 1e6},
+		{"G", "", 1e9},
+		{"T", "", 1e12},
+		{"Ki", "", 1 << 10},
+		{"Mi", "", 1 << 20},
+		{"Gi", "", 1 << 30},
+		{"Ti", "", 1 << 40},
+	} {
+		units[u.name] = u
+	}
+}
+
+func lookupUnit(name string) (*unit, error) {
+	u, ok := units[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown unit %q", name)
+	}
+	return &u, nil
+}
+
+var numUnitRE = regexp.MustCompile(`^([-+]?(?:[0-9]+\.?[0-9]*|\.[0-9]+)(?:[eE][-+]?[0-9]+)?)\s*(.*)$`)
+
+// parse parses a number with an optional unit suffix and returns it in
+// units of u. A number without a suffix is already in units of u.
+// Plain multipliers like k and Mi scale the number without changing its
+// unit, so with u=ms, 4k means 4000ms.
+func (u *unit) parse(s string) (float64, error) {
+	m := numUnitRE.FindStringSubmatch(s)
+	if m == nil {
+		return strconv.ParseFloat(s, 64) // for the error, or inf and nan
+	}
+	v, err := strconv.ParseFloat(m[1], 64)
+	if err != nil || m[2] == "" {
+		return v, err
+	}
+	vu, ok := units[m[2]]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit in %q", s)
+	}
+	switch vu.dim {
+	case "":
+		return v * vu.scale, nil
+	case u.dim:
+		return v * vu.scale / u.scale, nil
+	}
+	return 0, fmt.Errorf("can't convert %q to %s", s, u.name)
+}
+
+// humanUnits lists, for each dimension, the units to print values in.
+var humanUnits = map[string][]string{
+	"time":  {"ns", "µs", "ms", "s"},
+	"bytes": {"B", "KiB", "MiB", "GiB", "TiB", "PiB"},
+	"":      {"1", "k", "M", "G", "T"},
+}
+
+// human formats v, which is in units of u, using the largest unit that
+// keeps the number at least 1. prec is the number of digits after the
+// decimal point, or -1 for four significant digits.
+func (u *unit) human(v float64, prec int) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	base := v * u.scale
+	names := humanUnits[u.dim]
+	best := units[names[0]]
+	for _, name := range names[1:] {
+		if hu := units[name]; math.Abs(base) >= hu.scale {
+			best = hu
+		}
+	}
+	x := base / best.scale
+	var num string
+	if prec < 0 {
+		num = strconv.FormatFloat(x, 'g', 4, 64)
+		if strings.ContainsAny(num, "e") {
+			num = strconv.FormatFloat(x, 'f', -1, 64)
+		}
+	} else {
+		num = strconv.FormatFloat(x, 'f', prec, 64)
+	}
+	if best.name == "1" {
+		return num
+	}
+	return num + best.name
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// windowing places timestamped rows into time windows. Windows start at
+// multiples of step since the Unix epoch and last for size, so they
+// overlap when step is less than size.
+type windowing struct {
+	col    int    // 0-based timestamp column
+	format string // timestamp format, see parseTime
+	size   time.Duration
+	step   time.Duration
+	loc    *time.Location // of the first timestamp, for printing
+}
+
+func validTimeFormat(f string) bool {
+	switch f {
+	case "auto", "rfc3339", "unix", "unixms":
+		return true
+	}
+	return false
+}
+
+// parseTime parses a timestamp. RFC3339 timestamps may have fractional
+// seconds. Unix timestamps may have a fractional part; in auto format,
+// numbers too large to be seconds since 1970 up to 5000 AD are taken
+// to be milliseconds.
+func (w *windowing) parseTime(s string) (time.Time, error) {
+	format := w.format
+	if format == "auto" {
+		format = "rfc3339"
+		if strings.Trim(s, "0123456789.") == "" {
+			format = "unix"
+		}
+	}
+	if format == "rfc3339" {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("bad timestamp %q", s)
+		}
+		return t, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return time.Time{}, fmt.Errorf("bad timestamp %q", s)
+	}
+	if format == "unixms" || w.format == "auto" && v >= 1e11 {
+		v /= 1e3
+	}
+	sec, frac := math.Modf(v)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+}
+
+// windows returns the indexes of the windows that contain t.
+// Window k starts at k*step.
+func (w *windowing) windows(t time.Time) (first, last int64) {
+	ns := t.UnixNano()
+	return floorDiv(ns-int64(w.size), int64(w.step)) + 1, floorDiv(ns, int64(w.step))
+}
+
+// start returns the start of window k.
+func (w *windowing) start(k int64) time.Time {
+	t := time.Unix(0, k*int64(w.step))
+	if w.loc != nil {
+		t = t.In(w.loc)
+	}
+	return t
+}
+
+func (w *windowing) label(k int64) string {
+	return w.start(k).Format(time.RFC3339Nano)
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
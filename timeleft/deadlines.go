@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+func defaultDeadlinesFile() string {
+	return filepath.Join(xdgConfigDir(), "timeleft", "deadlines.toml")
+}
+
+func xdgConfigDir() string {
+	if d := os.Getenv("XDG_CONFIG_HOME"); d != "" {
+		return d
+	}
+	var h string
+	if u, err := user.Current(); err == nil {
+		h = u.HomeDir
+	} else {
+		h = os.Getenv("HOME")
+	}
+	return filepath.Join(h, ".config")
+}
+
+type deadline struct {
+	Name   string    `toml:"name"`
+	Date   time.Time `toml:"date"`
+	Repeat string    `toml:"repeat,omitempty"` // see parseSchedule
+
+	// Except are occurrences of an RRULE that are skipped, as given
+	// by EXDATE in iCalendar files.
+	Except []time.Time `toml:"-"`
+}
+
+// next returns d with the date of its next occurrence at or after now,
+// if it repeats.
+func (d deadline) next(now time.Time) (deadline, error) {
+	if d.Repeat == "" {
+		return d, nil
+	}
+	sched, err := parseSchedule(d.Repeat)
+	if err != nil {
+		return d, fmt.Errorf("%s: %v", d.Name, err)
+	}
+	if r, ok := sched.(*rrule); ok {
+		r.exdates = d.Except
+	}
+	if d.Date = sched.next(d.Date, now); d.Date.IsZero() {
+		return d, fmt.Errorf("%s: schedule %q never matches", d.Name, d.Repeat)
+	}
+	return d, nil
+}
+
+type deadlineList struct {
+	Deadlines []deadline `toml:"deadline"`
+}
+
+// loadDeadlines reads the deadlines file at p.
+// A missing file has no deadlines.
+func loadDeadlines(p string) (*deadlineList, error) {
+	var l deadlineList
+	if _, err := toml.DecodeFile(p, &l); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// save replaces the deadlines file at p with l.
+func (l *deadlineList) save(p string) error {
+	sort.SliceStable(l.Deadlines, func(i, j int) bool {
+		return l.Deadlines[i].Date.Before(l.Deadlines[j].Date)
+	})
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(l); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), ".deadlines")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf.Bytes())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (l *deadlineList) find(name string) int {
+	for i, d := range l.Deadlines {
+		if d.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func mustLoad(p string) *deadlineList {
+	l, err := loadDeadlines(p)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return l
+}
+
+func add(p string, d deadline) {
+	if _, err := d.next(d.Date); err != nil {
+		log.Fatal(err)
+	}
+	l := mustLoad(p)
+	if i := l.find(d.Name); i >= 0 {
+		l.Deadlines[i] = d
+	} else {
+		l.Deadlines = append(l.Deadlines, d)
+	}
+	if err := l.save(p); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func remove(p, name string) {
+	l := mustLoad(p)
+	i := l.find(name)
+	if i < 0 {
+		log.Fatalf("no deadline named %q", name)
+	}
+	l.Deadlines = append(l.Deadlines[:i], l.Deadlines[i+1:]...)
+	if err := l.save(p); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func list(p string) {
+	l := mustLoad(p)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, d := range l.Deadlines {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", d.Name, d.Date.Format("Mon Jan 2 15:04 MST 2006"), d.Repeat)
+	}
+	tw.Flush()
+}
+
+// upcoming returns the next occurrences of deadlines, soonest first,
+// skipping those that passed more than grace before now.
+func upcoming(deadlines []deadline, now time.Time, grace time.Duration) []deadline {
+	var ds []deadline
+	for _, d := range deadlines {
+		d, err := d.next(now)
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+		if d.Date.Sub(now) >= -grace {
+			ds = append(ds, d)
+		}
+	}
+	sort.SliceStable(ds, func(i, j int) bool {
+		return ds[i].Date.Before(ds[j].Date)
+	})
+	return ds
+}
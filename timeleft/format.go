@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type durUnit struct {
+	name string
+	d    time.Duration
+}
+
+// calUnits are the units that time left is given in, largest first.
+var calUnits = []durUnit{
+	{"weeks", 7 * 24 * time.Hour},
+	{"days", 24 * time.Hour},
+	{"hours", time.Hour},
+	{"min", time.Minute},
+	{"sec", time.Second},
+}
+
+var unitNames = map[string]time.Duration{
+	"w": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour,
+	"h": time.Hour, "hour": time.Hour, "hours": time.Hour,
+	"m": time.Minute, "min": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"s": time.Second, "sec": time.Second, "second": time.Second, "seconds": time.Second,
+}
+
+// A durFormat says how to print time left.
+type durFormat struct {
+	format   string // text, iso or json
+	n        int    // most units to print
+	smallest time.Duration
+	total    *durUnit // if set, print a decimal number of this unit
+}
+
+// out is the output format.
+var out = &durFormat{format: "text", n: 2, smallest: time.Minute}
+
+func newDurFormat(format string, n int, smallest, total string) (*durFormat, error) {
+	f := &durFormat{format: format, n: n}
+	switch format {
+	case "text", "iso", "json":
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	if n < 1 {
+		return nil, fmt.Errorf("must print at least one unit")
+	}
+	var ok bool
+	if f.smallest, ok = unitNames[smallest]; !ok {
+		return nil, fmt.Errorf("unknown unit %q", smallest)
+	}
+	if total != "" {
+		d, ok := unitNames[total]
+		if !ok {
+			return nil, fmt.Errorf("unknown unit %q", total)
+		}
+		for _, u := range calUnits {
+			if u.d == d {
+				f.total = &durUnit{u.name, d}
+			}
+		}
+	}
+	return f, nil
+}
+
+// left describes the time left d, like "is in 3 days 4 hours",
+// or if d is negative, the time since, like "was 2 hours ago".
+func (f *durFormat) left(d time.Duration) string {
+	pre, post := "is in ", ""
+	if d < 0 {
+		pre, post = "was ", " ago"
+		d = -d
+	}
+	if f.total != nil {
+		v := strconv.FormatFloat(float64(d)/float64(f.total.d), 'f', 1, 64)
+		return pre + strings.TrimSuffix(v, ".0") + " " + f.total.name + post
+	}
+	if p := f.phrase(d, calUnits); p != "" {
+		return pre + p + post
+	}
+	return "is now"
+}
+
+// phrase gives d in the first f.n nonzero units, largest first, down to
+// the smallest unit, or "" if they're all zero.
+func (f *durFormat) phrase(d time.Duration, units []durUnit) string {
+	var buf bytes.Buffer
+	var fieldCount int
+	for _, u := range units {
+		if u.d < f.smallest {
+			break
+		}
+		n := int(d / u.d)
+		d -= time.Duration(n) * u.d
+		printIfPresent(&buf, &fieldCount, f.n, u.name, n)
+	}
+	if fieldCount == 0 {
+		return ""
+	}
+	buf.Truncate(buf.Len() - 1)
+	return buf.String()
+}
+
+// isoDuration formats d as an ISO 8601 duration like P3DT4H30M,
+// truncated to the smallest unit. Negative durations start with a minus.
+func isoDuration(d, smallest time.Duration) string {
+	var buf bytes.Buffer
+	if d < 0 {
+		buf.WriteByte('-')
+		d = -d
+	}
+	d -= d % smallest
+	buf.WriteByte('P')
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	if days > 0 {
+		fmt.Fprintf(&buf, "%dD", days)
+	}
+	if d > 0 || days == 0 {
+		buf.WriteByte('T')
+		h, m, s := d/time.Hour, d%time.Hour/time.Minute, d%time.Minute/time.Second
+		if h > 0 {
+			fmt.Fprintf(&buf, "%dH", h)
+		}
+		if m > 0 {
+			fmt.Fprintf(&buf, "%dM", m)
+		}
+		if s > 0 || h == 0 && m == 0 {
+			fmt.Fprintf(&buf, "%dS", s)
+		}
+	}
+	return buf.String()
+}
+
+type jsonEvent struct {
+	Event       string    `json:"event"`
+	Date        time.Time `json:"date"`
+	Seconds     int64     `json:"seconds"` // negative once passed
+	Left        string    `json:"left"`
+	WorkSeconds *int64    `json:"work_seconds,omitempty"`
+}
+
+// jsonLine returns a JSON object describing event at t, d from now,
+// with work time left if there's a working calendar.
+func jsonLine(event string, t time.Time, d, work time.Duration) string {
+	e := jsonEvent{
+		Event:   event,
+		Date:    t,
+		Seconds: int64(d / time.Second),
+		Left:    out.left(d),
+	}
+	if cal != nil {
+		ws := int64(work / time.Second)
+		e.WorkSeconds = &ws
+	}
+	b, _ := json.Marshal(e)
+	return string(b)
+}
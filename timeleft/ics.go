@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// readICS returns the events in the iCalendar file at p whose summaries
+// match. Recurring events repeat by their RRULE, skipping the dates in
+// EXDATE. An event with a RECURRENCE-ID moves one occurrence of the
+// recurring event with the same UID, or cancels it if its STATUS is
+// CANCELLED. Events with no summary or start are skipped, as are other
+// components like VTODO.
+func readICS(p string, match *regexp.Regexp) ([]deadline, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	lines, err := unfold(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+
+	var (
+		evs     []icsEvent
+		e       icsEvent
+		inEvent bool
+		depth   int // of components nested in the event, like VALARM
+	)
+	for i, line := range lines {
+		name, params, value, ok := parseContentLine(line)
+		if !ok {
+			return nil, fmt.Errorf("%s: bad line %d: %q", p, i+1, line)
+		}
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			inEvent, e = true, icsEvent{}
+		case !inEvent:
+		case name == "BEGIN":
+			depth++
+		case name == "END" && depth > 0:
+			depth--
+		case depth > 0:
+		case name == "END":
+			inEvent = false
+			evs = append(evs, e)
+		case name == "SUMMARY":
+			e.Name = unescapeText(value)
+		case name == "UID":
+			e.uid = value
+		case name == "STATUS":
+			e.cancelled = strings.EqualFold(value, "CANCELLED")
+		case name == "DTSTART":
+			if e.Date, err = parseICalTime(value, paramLoc(params)); err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", p, i+1, err)
+			}
+		case name == "RECURRENCE-ID":
+			if e.recurrence, err = parseICalTime(value, paramLoc(params)); err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", p, i+1, err)
+			}
+		case name == "RRULE":
+			e.Repeat = value
+		case name == "EXDATE":
+			for _, v := range strings.Split(value, ",") {
+				t, err := parseICalTime(v, paramLoc(params))
+				if err != nil {
+					return nil, fmt.Errorf("%s:%d: %v", p, i+1, err)
+				}
+				e.Except = append(e.Except, t)
+			}
+		}
+	}
+
+	// Take the occurrences that were moved or cancelled out of the
+	// recurring events.
+	recurring := make(map[string]int)
+	for i, e := range evs {
+		if e.uid != "" && e.recurrence.IsZero() {
+			recurring[e.uid] = i
+		}
+	}
+	for i := range evs {
+		e := &evs[i]
+		if e.recurrence.IsZero() {
+			continue
+		}
+		e.Repeat = ""
+		if j, ok := recurring[e.uid]; ok {
+			evs[j].Except = append(evs[j].Except, e.recurrence)
+			if e.Name == "" {
+				e.Name = evs[j].Name
+			}
+		}
+	}
+
+	var ds []deadline
+	for _, e := range evs {
+		if !e.cancelled && e.Name != "" && !e.Date.IsZero() && (match == nil || match.MatchString(e.Name)) {
+			ds = append(ds, e.deadline)
+		}
+	}
+	return ds, nil
+}
+
+// An icsEvent is a VEVENT as read, before moved occurrences are
+// matched up with their recurring events.
+type icsEvent struct {
+	deadline
+	uid        string
+	recurrence time.Time // the occurrence this event replaces, if any
+	cancelled  bool
+}
+
+// paramLoc returns the zone named by the TZID parameter, or nil.
+// Zones that aren't in the tz database, like Windows names, are taken
+// as local.
+func paramLoc(params map[string]string) *time.Location {
+	if tzid := params["TZID"]; tzid != "" {
+		if loc, err := time.LoadLocation(tzid); err == nil {
+			return loc
+		}
+	}
+	return nil
+}
+
+// unfold returns the logical lines of r, joining lines that continue
+// on the next one by starting it with a space or tab.
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, s.Err()
+}
+
+// parseContentLine splits a line like DTSTART;TZID=Europe/Paris:20261101T170000
+// into its upper-cased name, parameters and value.
+func parseContentLine(line string) (name string, params map[string]string, value string, ok bool) {
+	// The value follows the first colon that isn't in a quoted
+	// parameter value.
+	quoted := false
+	colon := -1
+	for i := 0; i < len(line) && colon < 0; i++ {
+		switch line[i] {
+		case '"':
+			quoted = !quoted
+		case ':':
+			if !quoted {
+				colon = i
+			}
+		}
+	}
+	if colon < 0 {
+		return "", nil, "", false
+	}
+	parts := strings.Split(line[:colon], ";")
+	params = make(map[string]string)
+	for _, p := range parts[1:] {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) == 2 {
+			params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:], true
+}
+
+// parseICalTime parses a DATE or DATE-TIME value. Times ending in Z are
+// in UTC; others are in loc, or local time if loc is nil. Dates are
+// midnight at the start of the day.
+func parseICalTime(s string, loc *time.Location) (time.Time, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	var layout string
+	switch {
+	case len(s) == len("20060102"):
+		layout = "20060102"
+	case strings.HasSuffix(s, "Z"):
+		layout, loc = "20060102T150405Z", time.UTC
+	default:
+		layout = "20060102T150405"
+	}
+	t, err := time.ParseInLocation(layout, s, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad date %q", s)
+	}
+	return t, nil
+}
+
+var textEscapes = strings.NewReplacer(`\\`, `\`, `\;`, `;`, `\,`, `,`, `\n`, " ", `\N`, " ")
+
+func unescapeText(s string) string {
+	return textEscapes.Replace(s)
+}
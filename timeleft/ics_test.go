@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testICS = `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+UID:standup@example.com
+SUMMARY:standup
+DTSTART;TZID=America/New_York:20261005T093000
+RRULE:FREQ=WEEKLY;BYDAY=MO,WE
+EXDATE;TZID=America/New_York:20261019T093000,20261021T093000
+EXDATE;TZID=America/New_York:20261026T093000
+END:VEVENT
+BEGIN:VEVENT
+UID:standup@example.com
+RECURRENCE-ID;TZID=America/New_York:20261028T093000
+DTSTART;TZID=America/New_York:20261028T110000
+END:VEVENT
+BEGIN:VEVENT
+UID:standup@example.com
+RECURRENCE-ID;TZID=America/New_York:20261102T093000
+STATUS:CANCELLED
+END:VEVENT
+BEGIN:VEVENT
+UID:review@example.com
+SUMMARY:review
+DTSTART;VALUE=DATE:20261101
+BEGIN:VALARM
+SUMMARY:not an event
+END:VALARM
+END:VEVENT
+END:VCALENDAR
+`
+
+func TestReadICS(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "cal.ics")
+	if err := os.WriteFile(p, []byte(testICS), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ds, err := readICS(p, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	at := func(m time.Month, d, h, min int) time.Time { return time.Date(2026, m, d, h, min, 0, 0, ny) }
+	review := time.Date(2026, 11, 1, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		now  time.Time
+		want []deadline
+	}{
+		// The 19th, 21st and 26th are skipped, the 28th is moved and
+		// 2 November is cancelled.
+		{at(10, 19, 0, 0), []deadline{
+			{Name: "standup", Date: at(10, 28, 11, 0)},
+			{Name: "review", Date: review},
+			{Name: "standup", Date: at(11, 4, 9, 30)},
+		}},
+		{at(10, 28, 12, 0), []deadline{
+			{Name: "review", Date: review},
+			{Name: "standup", Date: at(11, 4, 9, 30)},
+		}},
+	}
+	for _, test := range tests {
+		up := upcoming(ds, test.now, 0)
+		ok := len(up) == len(test.want)
+		for i := 0; ok && i < len(up); i++ {
+			ok = up[i].Name == test.want[i].Name && up[i].Date.Equal(test.want[i].Date)
+		}
+		if !ok {
+			t.Errorf("at %v: upcoming = %s, want %s", test.now, formatDeadlines(up), formatDeadlines(test.want))
+		}
+	}
+}
+
+func formatDeadlines(ds []deadline) string {
+	var b strings.Builder
+	for _, d := range ds {
+		fmt.Fprintf(&b, "\n\t%s %v", d.Name, d.Date)
+	}
+	return b.String()
+}
@@ -1,79 +1,290 @@
 /*
-
 Timeleft prints the amount of time left until some date.
 It can be used as a countdown timer for deadlines.
 
 Usage:
 
-	timeleft datestamp
+	timeleft [options] event datestamp
+	timeleft [options] [list | add event datestamp | remove event]
+
+where datestamp is in one of the forms below:
+
+	Mon Jan 2 15:04:05 MST 2006    time.UnixDate
+	2006-01-02T15:04:05-07:00      RFC 3339
+	2006-01-02                     midnight at the start of the day
+	2006-01-02 15:04               also 2006-01-02 3pm and 2006-01-02T15:04
+	friday 5pm                     the next Friday at 5pm
+	fri, tomorrow, today           midnight, or at a time like "fri at 17:30"
+	17:30, 5:30pm, noon            the next time it's that time of day
+	+3d4h                          from now, in w, d, h, m and s
+
+Forms without a zone are in local time, unless followed by a time zone
+name like Europe/Paris or UTC, or an offset like +0530 or -07:00.
+
+Deadlines can be saved in a file, by default
+$XDG_CONFIG_HOME/timeleft/deadlines.toml, using add, which replaces any
+deadline with the same name, and remove. Run without arguments, timeleft
+prints the time left until each saved deadline, soonest first. Deadlines
+that have passed are shown with the time since, like "was 2 hours ago",
+and hidden after a grace period. The list subcommand prints the saved
+deadlines with their dates.
+
+With -repeat, an event recurs daily, weekly, monthly or yearly from its
+date, on a cron schedule like "0 17 * * fri" (see crontab(5)), for
+which the date may be left out, or by an iCalendar RRULE like
+"FREQ=MONTHLY;BYDAY=-1FR". The time left is until the next occurrence.
+
+With -ics, the events are read from an iCalendar file instead of the
+deadlines file. Events that repeat by RRULE are supported, along with
+dates excluded by EXDATE and occurrences moved or cancelled by events
+with a RECURRENCE-ID, as are time zones given by TZID and all-day
+events, which start at local midnight.
+With -match, only events whose summaries match a regular expression are
+shown.
+
+The file is TOML with a table for each deadline:
 
-where datestamp is of the time.UnixDate form
-as seen below:
+	[[deadline]]
+	name = "camera-ready"
+	date = 2026-11-01T17:00:00-07:00
 
-	Mon Jan 2 15:04:05 MST 2006
+	[[deadline]]
+	name = "standup"
+	date = 2026-10-19T09:30:00-07:00
+	repeat = "30 9 * * mon-fri"
 
+With -work, timeleft also prints the working time left, counting only
+working hours, like 9-18, on days that aren't weekend days or holidays.
+Working time is given in working days as long as the working hours. The
+holidays file, by default $XDG_CONFIG_HOME/timeleft/holidays, has a date
+like 2026-12-25 on each line, optionally followed by a # and a comment.
+
+With -watch, timeleft keeps the countdown updated in place, every second
+in the last hour before a deadline and every minute otherwise, until the
+deadlines pass. With -notify, it rings the bell, or runs the -exec command,
+when a deadline comes within each of the given times, like 1d,1h,10m. The
+command is run by sh with TIMELEFT_EVENT, TIMELEFT_DATE and TIMELEFT_BEFORE
+set to the deadline's name, its date and the notification time.
+
+Time left is printed in at most two units, down to minutes, like
+"1 weeks 2 days"; -units and -smallest change these. With -total, it's
+printed as a decimal number of one unit, like "83.5 hours". The iso
+format prints each deadline's name and the time left as an ISO 8601
+duration like P3DT4H30M, negative once the deadline has passed. The json
+format prints an object per deadline with its name, date, the seconds
+left, and the seconds of working time left with -work.
+
+Options:
+
+	-exec command
+		with -watch, shell command to run when notifying instead of ringing the bell
+	-f file
+		deadlines file
+	-format format
+		output format: text, iso (ISO 8601 durations) or json (one object per line) (default "text")
+	-grace duration
+		how long past deadlines are still listed (default 24h0m0s)
+	-ics file
+		read events from the iCalendar file instead of the deadlines file
+	-holidays file
+		with -work, file of holiday dates like 2006-01-02, one per line
+	-hours hours
+		with -work, working hours like 9-18 (default all day)
+	-match regexp
+		with -ics, only show events whose summaries match the regexp
+	-notify times
+		with -watch, comma-separated times before deadlines to notify at, like 1d,1h,10m
+	-repeat schedule
+		the event recurs schedule: daily, weekly, monthly, yearly, a cron expression or an RRULE
+	-smallest unit
+		smallest unit to print: weeks, days, hours, min or sec (default "min")
+	-total unit
+		print the time left as a decimal number of this one unit, like hours
+	-units int
+		number of units to print (default 2)
+	-watch
+		keep the countdown updated in place until the deadlines pass
+	-weekend string
+		with -work, comma-separated days that are not worked (default "sat,sun")
+	-work
+		also print the working time left
 */
 package main
 
 import (
 	"bytes"
+	"flag"
 	"fmt"
-	"io"
 	"log"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 )
 
+var (
+	deadlinesFile = flag.String("f", defaultDeadlinesFile(), "deadlines `file`")
+	grace         = flag.Duration("grace", 24*time.Hour, "how long past deadlines are still listed")
+	work          = flag.Bool("work", false, "also print the working time left")
+	weekend       = flag.String("weekend", "sat,sun", "with -work, comma-separated days that are not worked")
+	workHours     = flag.String("hours", "", "with -work, working `hours` like 9-18 (default all day)")
+	holidaysFile  = flag.String("holidays", defaultHolidaysFile(), "with -work, `file` of holiday dates like 2006-01-02, one per line")
+	watchMode     = flag.Bool("watch", false, "keep the countdown updated in place until the deadlines pass")
+	notifyAt      = flag.String("notify", "", "with -watch, comma-separated `times` before deadlines to notify at, like 1d,1h,10m")
+	notifyCmd     = flag.String("exec", "", "with -watch, shell `command` to run when notifying instead of ringing the bell")
+	nUnits        = flag.Int("units", 2, "number of units to print")
+	smallestUnit  = flag.String("smallest", "min", "smallest `unit` to print: weeks, days, hours, min or sec")
+	totalUnit     = flag.String("total", "", "print the time left as a decimal number of this one `unit`, like hours")
+	repeat        = flag.String("repeat", "", "the event recurs `schedule`: daily, weekly, monthly, yearly, a cron expression or an RRULE")
+	icsFile       = flag.String("ics", "", "read events from the iCalendar `file` instead of the deadlines file")
+	icsMatch      = flag.String("match", "", "with -ics, only show events whose summaries match the `regexp`")
+	outFormat     = flag.String("format", "text", "output `format`: text, iso (ISO 8601 durations) or json (one object per line)")
+)
+
+// cal is the working calendar, if -work is set.
+var cal *workCal
+
 func usage() {
-	fmt.Fprintf(os.Stderr, "usage: timeleft event datestamp\n")
+	fmt.Fprintln(os.Stderr, "usage: timeleft [options] event datestamp")
+	fmt.Fprintln(os.Stderr, "       timeleft [options] [list | add event datestamp | remove event]")
+	flag.PrintDefaults()
 	os.Exit(2)
 }
 
 func main() {
 	log.SetPrefix("timeleft: ")
 	log.SetFlags(0)
-	if len(os.Args) < 3 {
-		usage()
+	flag.Usage = usage
+	flag.Parse()
+	args := flag.Args()
+	now := time.Now()
+	var err error
+	if out, err = newDurFormat(*outFormat, *nUnits, *smallestUnit, *totalUnit); err != nil {
+		log.Fatal(err)
 	}
-	event := os.Args[1]
-	datestamp := strings.Join(os.Args[2:], " ")
-	t, err := time.Parse(time.UnixDate, datestamp)
-	if err != nil {
-		log.Fatal("datestamp must be of the form: Mon Jan 2 15:04:05 MST 2006")
+	if *work {
+		if cal, err = newWorkCal(*weekend, *workHours, *holidaysFile); err != nil {
+			log.Fatal(err)
+		}
 	}
-	d := t.Sub(time.Now())
-	if d < 0 {
-		fmt.Println(event, "already happened")
-		return
+	var events func(now time.Time) []deadline
+	switch {
+	case *icsFile != "":
+		if len(args) != 0 {
+			usage()
+		}
+		var match *regexp.Regexp
+		if *icsMatch != "" {
+			if match, err = regexp.Compile(*icsMatch); err != nil {
+				log.Fatal(err)
+			}
+		}
+		ds, err := readICS(*icsFile, match)
+		if err != nil {
+			log.Fatal(err)
+		}
+		events = func(now time.Time) []deadline {
+			return upcoming(ds, now, *grace)
+		}
+	case len(args) == 0:
+		events = func(now time.Time) []deadline {
+			return upcoming(mustLoad(*deadlinesFile).Deadlines, now, *grace)
+		}
+	default:
+		events = oneEvent(args, now)
 	}
-	if d/time.Minute == 0 {
-		fmt.Println(event, "is now")
+	if !*watchMode {
+		for _, d := range events(now) {
+			fmt.Println(describe(d.Name, d.Date, now))
+		}
 		return
 	}
-	days := int(d/time.Hour) / 24
-	weeks := days / 7
-	hours := int(d/time.Hour) - 24*days
-	days = days - 7*weeks
-	min := int(d/time.Minute) - 60*int(d/time.Hour)
-
-	var buf bytes.Buffer
-	buf.WriteString(event)
-	buf.WriteString(" is in ")
-	var fieldCount int
-	printIfPresent(&buf, &fieldCount, "weeks", weeks)
-	printIfPresent(&buf, &fieldCount, "days", days)
-	printIfPresent(&buf, &fieldCount, "hours", hours)
-	printIfPresent(&buf, &fieldCount, "min", min)
-	buf.Truncate(buf.Len() - 1)
-	buf.WriteByte('\n')
-
-	io.Copy(os.Stdout, &buf)
+	thresholds, err := parseThresholds(*notifyAt)
+	if err != nil {
+		log.Fatal(err)
+	}
+	watch(os.Stdout, events, thresholds, *notifyCmd, out.format == "text")
+}
+
+// oneEvent handles the subcommands, which exit, or else returns the
+// event named on the command line.
+func oneEvent(args []string, now time.Time) func(time.Time) []deadline {
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			usage()
+		}
+		list(*deadlinesFile)
+		os.Exit(0)
+	case "add":
+		if len(args) < 2 {
+			usage()
+		}
+		add(*deadlinesFile, parseEvent(args[1:], now))
+		os.Exit(0)
+	case "remove":
+		if len(args) != 2 {
+			usage()
+		}
+		remove(*deadlinesFile, args[1])
+		os.Exit(0)
+	}
+	d := parseEvent(args, now)
+	return func(now time.Time) []deadline {
+		d, err := d.next(now)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return []deadline{d}
+	}
+}
+
+// parseEvent parses an event name followed by its date. With a cron
+// schedule, the date is optional; the schedule then starts now.
+func parseEvent(args []string, now time.Time) deadline {
+	d := deadline{Name: args[0], Date: now, Repeat: *repeat}
+	if len(args) == 1 {
+		if _, err := parseCron(*repeat); err != nil {
+			usage()
+		}
+		return d
+	}
+	var err error
+	if d.Date, err = parseDate(strings.Join(args[1:], " "), now); err != nil {
+		log.Fatal(err)
+	}
+	return d
+}
+
+// describe describes how long it is from now until event at t in the
+// output format, including the working time left if there's a working
+// calendar.
+func describe(event string, t, now time.Time) string {
+	d := t.Sub(now)
+	var work time.Duration
+	if cal != nil && d > 0 {
+		work = cal.workTime(now, t)
+	}
+	switch out.format {
+	case "iso":
+		return event + "\t" + isoDuration(d, out.smallest)
+	case "json":
+		return jsonLine(event, t, d, work)
+	}
+	s := event + " " + out.left(d)
+	if cal != nil && d > 0 {
+		w := out.phrase(work, cal.units())
+		if w == "" {
+			w = "no work time"
+		}
+		s += " (" + w + ")"
+	}
+	return s
 }
 
-func printIfPresent(buf *bytes.Buffer, numFields *int, name string, val int) {
-	if val != 0 && *numFields < 2 {
+func printIfPresent(buf *bytes.Buffer, numFields *int, max int, name string, val int) {
+	if val != 0 && *numFields < max {
 		buf.WriteString(strconv.Itoa(val))
 		buf.WriteByte(' ')
 		buf.WriteString(name)
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseDate parses a date in any of the forms described in the package
+// documentation. Forms that don't name a day, like weekdays and times
+// of day, are the next occurrence after now.
+func parseDate(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.UnixDate, time.RFC3339Nano} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	if strings.HasPrefix(s, "+") && !strings.ContainsAny(s, " :") {
+		return parseRelative(s, now)
+	}
+
+	fields := strings.Fields(strings.ToLower(s))
+	loc := now.Location()
+	if len(fields) > 1 {
+		if l, ok := parseZone(strings.Fields(s)[len(fields)-1]); ok {
+			loc = l
+			fields = fields[:len(fields)-1]
+		}
+	}
+	if len(fields) == 0 {
+		return time.Time{}, fmt.Errorf("bad date %q", s)
+	}
+	now = now.In(loc)
+
+	// The day, if any, comes first.
+	var (
+		day     time.Time
+		weekday = time.Weekday(-1)
+	)
+	switch f := fields[0]; {
+	case f == "today":
+		day = now
+		fields = fields[1:]
+	case f == "tomorrow":
+		day = now.AddDate(0, 0, 1)
+		fields = fields[1:]
+	case parseWeekday(f) >= 0:
+		weekday = parseWeekday(f)
+		fields = fields[1:]
+	default:
+		date, clock := f, ""
+		if i := strings.IndexByte(f, 't'); i > 0 {
+			date, clock = f[:i], f[i+1:]
+		}
+		if d, err := time.ParseInLocation("2006-01-02", date, loc); err == nil {
+			day = d
+			fields = fields[1:]
+			if clock != "" {
+				fields = append([]string{clock}, fields...)
+			}
+		}
+	}
+	hasDay := !day.IsZero() || weekday >= 0
+	if len(fields) > 0 && fields[0] == "at" {
+		fields = fields[1:]
+		if len(fields) == 0 {
+			return time.Time{}, fmt.Errorf("bad date %q: no time after at", s)
+		}
+	}
+
+	hour, min, sec := 0, 0, 0
+	if clock := strings.Join(fields, ""); clock != "" {
+		var err error
+		if hour, min, sec, err = parseClock(clock); err != nil {
+			return time.Time{}, fmt.Errorf("bad date %q", s)
+		}
+	} else if !hasDay {
+		return time.Time{}, fmt.Errorf("bad date %q", s)
+	}
+
+	if !day.IsZero() {
+		return time.Date(day.Year(), day.Month(), day.Day(), hour, min, sec, 0, loc), nil
+	}
+	// The next occurrence of the weekday, or of the time of day if
+	// there's no weekday.
+	for i := 0; i <= 7; i++ {
+		d := now.AddDate(0, 0, i)
+		t := time.Date(d.Year(), d.Month(), d.Day(), hour, min, sec, 0, loc)
+		if t.After(now) && (weekday < 0 || t.Weekday() == weekday) {
+			return t, nil
+		}
+	}
+	panic("unreachable")
+}
+
+// parseRelative parses a duration from now like +3d4h. The units are
+// w, d, h, m and s. Weeks and days are calendar days, so they keep the
+// time of day across daylight saving changes.
+func parseRelative(s string, now time.Time) (time.Time, error) {
+	rest := s[1:]
+	if rest == "" {
+		return time.Time{}, fmt.Errorf("bad relative date %q", s)
+	}
+	t := now
+	for rest != "" {
+		i := 0
+		for i < len(rest) && '0' <= rest[i] && rest[i] <= '9' {
+			i++
+		}
+		if i == 0 || i == len(rest) {
+			return time.Time{}, fmt.Errorf("bad relative date %q", s)
+		}
+		n, err := strconv.Atoi(rest[:i])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("bad relative date %q", s)
+		}
+		switch rest[i] {
+		case 'w':
+			t = t.AddDate(0, 0, 7*n)
+		case 'd':
+			t = t.AddDate(0, 0, n)
+		case 'h':
+			t = t.Add(time.Duration(n) * time.Hour)
+		case 'm':
+			t = t.Add(time.Duration(n) * time.Minute)
+		case 's':
+			t = t.Add(time.Duration(n) * time.Second)
+		default:
+			return time.Time{}, fmt.Errorf("bad unit %q in relative date %q", rest[i], s)
+		}
+		rest = rest[i+1:]
+	}
+	return t, nil
+}
+
+// parseZone parses a time zone name like Europe/Paris, UTC or EST,
+// or an offset like +0530, -07:00 or +9.
+func parseZone(s string) (*time.Location, bool) {
+	if s == "Z" || strings.EqualFold(s, "UTC") || strings.EqualFold(s, "GMT") {
+		return time.UTC, true
+	}
+	if s[0] == '+' || s[0] == '-' {
+		digits := strings.Replace(s[1:], ":", "", 1)
+		var h, m int
+		var err error
+		switch len(digits) {
+		case 1, 2:
+			h, err = strconv.Atoi(digits)
+		case 4:
+			if h, err = strconv.Atoi(digits[:2]); err == nil {
+				m, err = strconv.Atoi(digits[2:])
+			}
+		default:
+			return nil, false
+		}
+		if err != nil || h > 14 || m > 59 {
+			return nil, false
+		}
+		off := h*3600 + m*60
+		if s[0] == '-' {
+			off = -off
+		}
+		return time.FixedZone(s, off), true
+	}
+	loc, err := time.LoadLocation(s)
+	return loc, err == nil
+}
+
+// parseWeekday returns the weekday named by s, like friday or fri,
+// or -1.
+func parseWeekday(s string) time.Weekday {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if s == name || s == name[:3] {
+			return d
+		}
+	}
+	return -1
+}
+
+// parseClock parses a time of day like 17:00, 17:00:30, 5pm, 5:30pm,
+// noon or midnight.
+func parseClock(s string) (hour, min, sec int, err error) {
+	switch s {
+	case "noon":
+		return 12, 0, 0, nil
+	case "midnight":
+		return 0, 0, 0, nil
+	}
+	for _, layout := range []string{"15:04", "15:04:05", "3pm", "3:04pm", "3:04:05pm"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Hour(), t.Minute(), t.Second(), nil
+		}
+	}
+	return 0, 0, 0, fmt.Errorf("bad time of day %q", s)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	pdt := time.FixedZone("PDT", -7*3600)
+	// A Monday.
+	now := time.Date(2026, 10, 19, 10, 0, 0, 0, pdt)
+	at := func(d, h, min int) time.Time { return time.Date(2026, 10, d, h, min, 0, 0, pdt) }
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"Fri Oct 23 17:00:00 UTC 2026", time.Date(2026, 10, 23, 17, 0, 0, 0, time.UTC)},
+		{"2026-11-01T17:00:00-07:00", time.Date(2026, 11, 1, 17, 0, 0, 0, pdt)},
+		{"2026-11-01T17:00:00.5Z", time.Date(2026, 11, 1, 17, 0, 0, 5e8, time.UTC)},
+		{"2026-11-01", time.Date(2026, 11, 1, 0, 0, 0, 0, pdt)},
+		{"2026-11-01 15:04", time.Date(2026, 11, 1, 15, 4, 0, 0, pdt)},
+		{"2026-11-01 3pm", time.Date(2026, 11, 1, 15, 0, 0, 0, pdt)},
+		{"2026-11-01T15:04", time.Date(2026, 11, 1, 15, 4, 0, 0, pdt)},
+		{"2026-11-01 at 15:04:05", time.Date(2026, 11, 1, 15, 4, 5, 0, pdt)},
+
+		{"friday 5pm", at(23, 17, 0)},
+		{"Fri", at(23, 0, 0)},
+		{"fri at 17:30", at(23, 17, 30)},
+		{"fri 5:30 pm", at(23, 17, 30)},
+		{"monday", at(26, 0, 0)},
+		{"monday 11:00", at(19, 11, 0)},
+		{"monday 9:00", at(26, 9, 0)},
+		{"today 5pm", at(19, 17, 0)},
+		{"tomorrow", at(20, 0, 0)},
+		{"17:30", at(19, 17, 30)},
+		{"9am", at(20, 9, 0)},
+		{"noon", at(19, 12, 0)},
+		{"midnight", at(20, 0, 0)},
+
+		{"+3d4h", at(22, 14, 0)},
+		{"+1w", at(26, 10, 0)},
+		{"+90m", at(19, 11, 30)},
+		{"+30s", now.Add(30 * time.Second)},
+
+		{"2026-11-01 17:00 Europe/Paris", time.Date(2026, 11, 1, 17, 0, 0, 0, paris)},
+		{"2026-11-01 17:00 UTC", time.Date(2026, 11, 1, 17, 0, 0, 0, time.UTC)},
+		{"2026-11-01 17:00 +0530", time.Date(2026, 11, 1, 11, 30, 0, 0, time.UTC)},
+		{"2026-11-01 17:00 -07:00", time.Date(2026, 11, 1, 17, 0, 0, 0, pdt)},
+		{"fri 5pm +9", time.Date(2026, 10, 23, 8, 0, 0, 0, time.UTC)},
+		// It's already Tuesday in Tokyo.
+		{"tuesday Asia/Tokyo", time.Date(2026, 10, 27, 0, 0, 0, 0, time.FixedZone("JST", 9*3600))},
+	}
+	for _, test := range tests {
+		got, err := parseDate(test.in, now)
+		if err != nil {
+			t.Errorf("parseDate(%q): %v", test.in, err)
+			continue
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("parseDate(%q) = %v, want %v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestParseDateErrors(t *testing.T) {
+	now := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	for _, in := range []string{
+		"",
+		"banana",
+		"+",
+		"+3",
+		"+3x",
+		"+d",
+		"2026-13-01",
+		"2026-11-01 25:00",
+		"25:00",
+		"fri 5pm Mars/Olympus",
+		"fri at",
+		"UTC",
+		"2026-11-01 17:00 +15",
+	} {
+		if got, err := parseDate(in, now); err == nil {
+			t.Errorf("parseDate(%q) = %v, want error", in, got)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A schedule says when a recurring deadline happens again.
+type schedule interface {
+	// next returns the first occurrence at or after now of a
+	// deadline that first happens at start. If the schedule ends
+	// before now, it returns the last occurrence, and if it never
+	// matches, the zero time.
+	next(start, now time.Time) time.Time
+}
+
+// parseSchedule parses daily, weekly, monthly, yearly, a cron
+// expression like "0 17 * * fri", or an iCalendar RRULE like
+// FREQ=MONTHLY;BYDAY=-1FR.
+func parseSchedule(s string) (schedule, error) {
+	if strings.Contains(strings.ToUpper(s), "FREQ=") {
+		return parseRRule(s)
+	}
+	switch s {
+	case "daily":
+		return every{days: 1}, nil
+	case "weekly":
+		return every{days: 7}, nil
+	case "monthly":
+		return every{months: 1}, nil
+	case "yearly":
+		return every{years: 1}, nil
+	}
+	return parseCron(s)
+}
+
+// every repeats a deadline at a calendar interval, keeping its time of
+// day. Monthly deadlines on days some months lack spill over into the
+// next month, as with time.AddDate.
+type every struct {
+	years, months, days int
+}
+
+func (e every) at(start time.Time, k int) time.Time {
+	return start.AddDate(k*e.years, k*e.months, k*e.days)
+}
+
+func (e every) next(start, now time.Time) time.Time {
+	if !start.Before(now) {
+		return start
+	}
+	// Estimate the number of intervals, then correct for the
+	// varying lengths of days, months and years.
+	approx := time.Duration(e.years)*365*24*time.Hour +
+		time.Duration(e.months)*30*24*time.Hour +
+		time.Duration(e.days)*24*time.Hour
+	k := int(now.Sub(start) / approx)
+	for k > 0 && !e.at(start, k-1).Before(now) {
+		k--
+	}
+	for e.at(start, k).Before(now) {
+		k++
+	}
+	return e.at(start, k)
+}
+
+// A cron schedule matches times in the style of crontab(5). Its fields
+// are minute, hour, day of month, month and day of week, and each is a
+// comma-separated list of *, values, ranges like 1-5, or either with a
+// step like */15. Months and days of week may be given by name.
+type cron struct {
+	min, hour, dom, month, dow []bool
+	// If both are restricted, a day matches if it matches either
+	// the day of month or the day of week.
+	domStar, dowStar bool
+}
+
+var (
+	monthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	dowNames   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+func parseCron(s string) (*cron, error) {
+	fs := strings.Fields(strings.ToLower(s))
+	if len(fs) != 5 {
+		return nil, fmt.Errorf("bad schedule %q: want daily, weekly, monthly, yearly or a cron expression", s)
+	}
+	var c cron
+	var err error
+	if c.min, err = parseCronField(fs[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseCronField(fs[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if c.dom, err = parseCronField(fs[2], 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseCronField(fs[3], 1, 12, monthNames); err != nil {
+		return nil, err
+	}
+	// Sunday may be 0 or 7.
+	if c.dow, err = parseCronField(fs[4], 0, 7, dowNames); err != nil {
+		return nil, err
+	}
+	c.dow[0] = c.dow[0] || c.dow[7]
+	c.domStar = strings.HasPrefix(fs[2], "*")
+	c.dowStar = strings.HasPrefix(fs[4], "*")
+	return &c, nil
+}
+
+// parseCronField returns which values from lo to hi the field matches.
+// names, if any, name the values from lo on.
+func parseCronField(f string, lo, hi int, names []string) ([]bool, error) {
+	match := make([]bool, hi+1)
+	value := func(s string) (int, error) {
+		for i, name := range names {
+			if s == name {
+				return lo + i, nil
+			}
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < lo || n > hi {
+			return 0, fmt.Errorf("bad value %q in cron field %q", s, f)
+		}
+		return n, nil
+	}
+	for _, part := range strings.Split(f, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return nil, fmt.Errorf("bad step in cron field %q", f)
+			}
+			rng = part[:i]
+		}
+		first, last := lo, hi
+		if rng != "*" {
+			var err error
+			bounds := strings.SplitN(rng, "-", 2)
+			if first, err = value(bounds[0]); err != nil {
+				return nil, err
+			}
+			last = first
+			if len(bounds) == 2 {
+				if last, err = value(bounds[1]); err != nil {
+					return nil, err
+				}
+			} else if step > 1 {
+				last = hi
+			}
+			if first > last {
+				return nil, fmt.Errorf("bad range %q in cron field %q", rng, f)
+			}
+		}
+		for n := first; n <= last; n += step {
+			match[n] = true
+		}
+	}
+	return match, nil
+}
+
+func (c *cron) dayMatches(t time.Time) bool {
+	dom, dow := c.dom[t.Day()], c.dow[t.Weekday()]
+	if !c.domStar && !c.dowStar {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// next ignores the seconds of start.
+func (c *cron) next(start, now time.Time) time.Time {
+	t := now
+	if start.After(t) {
+		t = start
+	}
+	if t.Second() != 0 || t.Nanosecond() != 0 {
+		t = t.Truncate(time.Minute).Add(time.Minute)
+	}
+	// Every schedule matches within a few years, unless it asks for
+	// a day that doesn't exist, like February 30th.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		y, m, d := t.Date()
+		switch {
+		case !c.month[m]:
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+		case !c.hour[t.Hour()]:
+			t = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, t.Location())
+		case !c.min[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	tests := []struct {
+		sched      string
+		start, now string
+		want       string
+	}{
+		{"daily", "2026-10-01 09:00", "2026-10-19 10:00", "2026-10-20 09:00"},
+		{"daily", "2026-10-25 09:00", "2026-10-19 10:00", "2026-10-25 09:00"},
+		{"weekly", "2026-10-02 17:00", "2026-10-23 17:00", "2026-10-23 17:00"},
+		{"monthly", "2026-01-31 12:00", "2026-02-01 00:00", "2026-03-03 12:00"},
+		{"yearly", "2020-11-01 00:00", "2026-10-19 10:00", "2026-11-01 00:00"},
+
+		{"0 17 * * fri", "2026-01-01 00:00", "2026-10-19 10:00", "2026-10-23 17:00"},
+		{"30 9 * * mon-fri", "2026-01-01 00:00", "2026-10-19 09:30", "2026-10-19 09:30"},
+		{"30 9 * * mon-fri", "2026-01-01 00:00", "2026-10-19 09:31", "2026-10-20 09:30"},
+		{"*/15 * * * *", "2026-01-01 00:00", "2026-10-19 10:01", "2026-10-19 10:15"},
+		{"0 0 1 jan,jul *", "2026-01-01 00:00", "2026-10-19 10:00", "2027-01-01 00:00"},
+		{"0 0 13 * 5", "2026-01-01 00:00", "2026-10-19 10:00", "2026-10-23 00:00"},
+		{"0 0 13 * *", "2026-01-01 00:00", "2026-10-19 10:00", "2026-11-13 00:00"},
+		{"0 8 * * 7", "2026-01-01 00:00", "2026-10-19 10:00", "2026-10-25 08:00"},
+		{"0 0 29 2 *", "2026-01-01 00:00", "2026-10-19 10:00", "2028-02-29 00:00"},
+		{"0 0 30 2 *", "2026-01-01 00:00", "2026-10-19 10:00", ""},
+		{"0 12 * * *", "2026-12-01 00:00", "2026-10-19 10:00", "2026-12-01 12:00"},
+	}
+	for _, test := range tests {
+		s, err := parseSchedule(test.sched)
+		if err != nil {
+			t.Errorf("parseSchedule(%q): %v", test.sched, err)
+			continue
+		}
+		var want time.Time
+		if test.want != "" {
+			want = date(test.want)
+		}
+		if got := s.next(date(test.start), date(test.now)); !got.Equal(want) {
+			t.Errorf("%q from %s: next after %s = %v, want %v", test.sched, test.start, test.now, got, want)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, sched := range []string{
+		"0 17 * *",
+		"60 * * * *",
+		"0 24 * * *",
+		"0 0 0 * *",
+		"0 0 * 13 *",
+		"0 0 * * 8",
+		"0 0 5-1 * *",
+		"*/0 * * * *",
+		"0 0 * * funday",
+	} {
+		if _, err := parseSchedule(sched); err == nil {
+			t.Errorf("parseSchedule(%q) succeeded, want error", sched)
+		}
+	}
+}
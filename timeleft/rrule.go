@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An rrule is an iCalendar recurrence rule (RFC 5545, section 3.3.10),
+// like FREQ=WEEKLY;BYDAY=MO,WE. It supports the FREQ, INTERVAL, COUNT,
+// UNTIL, BYMONTH, BYMONTHDAY and BYDAY parts.
+type rrule struct {
+	freq       string
+	interval   int
+	count      int       // 0 for no limit
+	until      time.Time // zero for no limit
+	byMonth    []time.Month
+	byMonthDay []int // negative counts from the end of the month
+	byDay      []weekdayNum
+	exdates    []time.Time // occurrences to skip
+}
+
+// A weekdayNum is a BYDAY value like MO, 1MO or -1FR.
+type weekdayNum struct {
+	n   int // 0 for every such day in the period
+	day time.Weekday
+}
+
+var icalDays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+func parseRRule(s string) (*rrule, error) {
+	r := &rrule{interval: 1}
+	bad := func(part string) error { return fmt.Errorf("bad part %q in RRULE %q", part, s) }
+	for _, part := range strings.Split(strings.TrimPrefix(s, "RRULE:"), ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, bad(part)
+		}
+		k, v := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+		var err error
+		switch k {
+		case "FREQ":
+			switch v {
+			case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+				r.freq = v
+			default:
+				return nil, fmt.Errorf("unsupported frequency %s in RRULE %q", v, s)
+			}
+		case "INTERVAL":
+			if r.interval, err = strconv.Atoi(v); err != nil || r.interval < 1 {
+				return nil, bad(part)
+			}
+		case "COUNT":
+			if r.count, err = strconv.Atoi(v); err != nil || r.count < 1 {
+				return nil, bad(part)
+			}
+		case "UNTIL":
+			if r.until, err = parseICalTime(v, nil); err != nil {
+				return nil, bad(part)
+			}
+		case "BYMONTH":
+			for _, f := range strings.Split(v, ",") {
+				m, err := strconv.Atoi(f)
+				if err != nil || m < 1 || m > 12 {
+					return nil, bad(part)
+				}
+				r.byMonth = append(r.byMonth, time.Month(m))
+			}
+		case "BYMONTHDAY":
+			for _, f := range strings.Split(v, ",") {
+				d, err := strconv.Atoi(f)
+				if err != nil || d == 0 || d < -31 || d > 31 {
+					return nil, bad(part)
+				}
+				r.byMonthDay = append(r.byMonthDay, d)
+			}
+		case "BYDAY":
+			for _, f := range strings.Split(v, ",") {
+				if len(f) < 2 {
+					return nil, bad(part)
+				}
+				day, ok := icalDays[f[len(f)-2:]]
+				if !ok {
+					return nil, bad(part)
+				}
+				wn := weekdayNum{day: day}
+				if num := f[:len(f)-2]; num != "" {
+					if wn.n, err = strconv.Atoi(num); err != nil || wn.n == 0 {
+						return nil, bad(part)
+					}
+				}
+				r.byDay = append(r.byDay, wn)
+			}
+		case "WKST":
+			// Weeks start on Monday; other starts only matter for
+			// rules this doesn't support.
+		default:
+			return nil, fmt.Errorf("unsupported part %s in RRULE %q", k, s)
+		}
+	}
+	if r.freq == "" {
+		return nil, fmt.Errorf("RRULE %q has no FREQ", s)
+	}
+	return r, nil
+}
+
+// maxPeriods bounds the search for occurrences of rules whose
+// filters rarely or never match.
+const maxPeriods = 100000
+
+// next returns the first occurrence at or after now, or the last
+// occurrence if the rule ends before now.
+func (r *rrule) next(start, now time.Time) time.Time {
+	var last time.Time
+	n := 0
+	for k := 0; k < maxPeriods; k++ {
+		for _, t := range r.expand(start, k) {
+			if t.Before(start) {
+				continue
+			}
+			if !r.until.IsZero() && t.After(r.until) || r.count > 0 && n == r.count {
+				return last
+			}
+			// Skipped occurrences still count toward COUNT.
+			n++
+			if r.excluded(t) {
+				continue
+			}
+			last = t
+			if !t.Before(now) {
+				return t
+			}
+		}
+	}
+	return last
+}
+
+func (r *rrule) excluded(t time.Time) bool {
+	for _, x := range r.exdates {
+		if x.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// expand returns the candidate occurrences in the kth period after
+// the one containing start, in order.
+func (r *rrule) expand(start time.Time, k int) []time.Time {
+	y, m, d := start.Date()
+	h, min, sec := start.Clock()
+	loc := start.Location()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, h, min, sec, 0, loc)
+	}
+	var ts []time.Time
+	switch r.freq {
+	case "DAILY":
+		ts = []time.Time{at(y, m, d+k*r.interval)}
+	case "WEEKLY":
+		day := at(y, m, d+7*k*r.interval)
+		if len(r.byDay) == 0 {
+			ts = []time.Time{day}
+			break
+		}
+		monday := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		for _, wn := range r.byDay {
+			ts = append(ts, monday.AddDate(0, 0, (int(wn.day)+6)%7))
+		}
+	case "MONTHLY":
+		first := at(y, m+time.Month(k*r.interval), 1)
+		ts = r.days(first, first.AddDate(0, 1, 0), d)
+	case "YEARLY":
+		y += k * r.interval
+		switch {
+		case len(r.byMonth) > 0:
+			for _, mo := range r.byMonth {
+				first := at(y, mo, 1)
+				ts = append(ts, r.days(first, first.AddDate(0, 1, 0), d)...)
+			}
+		case len(r.byDay) > 0 || len(r.byMonthDay) > 0:
+			// Without BYMONTH, the days are picked from the whole year,
+			// so 20MO is the year's 20th Monday.
+			ts = r.days(at(y, 1, 1), at(y+1, 1, 1), d)
+		default:
+			first := at(y, m, 1)
+			ts = r.days(first, first.AddDate(0, 1, 0), d)
+		}
+	}
+	var keep []time.Time
+	for _, t := range ts {
+		if r.matches(t) {
+			keep = append(keep, t)
+		}
+	}
+	sort.Slice(keep, func(i, j int) bool { return keep[i].Before(keep[j]) })
+	// BYDAY values like MO and 1MO may both give the same day.
+	out := keep[:0]
+	for i, t := range keep {
+		if i == 0 || !t.Equal(keep[i-1]) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// days returns the days from first up to end, which start months, that
+// are given by BYDAY and BYMONTHDAY, or else day of each month, unless
+// the month is too short. If both are given, days must match both.
+func (r *rrule) days(first, end time.Time, day int) []time.Time {
+	var ts []time.Time
+	if len(r.byDay) == 0 {
+		mdays := r.byMonthDay
+		if len(mdays) == 0 {
+			mdays = []int{day}
+		}
+		for month := first; month.Before(end); month = month.AddDate(0, 1, 0) {
+			ndays := daysIn(month)
+			for _, md := range mdays {
+				if md < 0 {
+					md += ndays + 1
+				}
+				if md >= 1 && md <= ndays {
+					ts = append(ts, month.AddDate(0, 0, md-1))
+				}
+			}
+		}
+		return ts
+	}
+	for _, wn := range r.byDay {
+		// Days in the period that fall on wn.day.
+		var days []time.Time
+		for t := first.AddDate(0, 0, (int(wn.day)-int(first.Weekday())+7)%7); t.Before(end); t = t.AddDate(0, 0, 7) {
+			days = append(days, t)
+		}
+		switch {
+		case wn.n == 0:
+		case wn.n > 0 && wn.n <= len(days):
+			days = days[wn.n-1 : wn.n]
+		case wn.n < 0 && -wn.n <= len(days):
+			days = days[len(days)+wn.n : len(days)+wn.n+1]
+		default:
+			days = nil
+		}
+		for _, t := range days {
+			if r.matchesMonthDay(t) {
+				ts = append(ts, t)
+			}
+		}
+	}
+	return ts
+}
+
+// daysIn returns the number of days in the month of t.
+func daysIn(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// matchesMonthDay reports whether t is one of the BYMONTHDAY days,
+// if any are given.
+func (r *rrule) matchesMonthDay(t time.Time) bool {
+	if len(r.byMonthDay) == 0 {
+		return true
+	}
+	for _, md := range r.byMonthDay {
+		if md < 0 {
+			md += daysIn(t) + 1
+		}
+		if md == t.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether t passes the filters that don't expand the
+// period: BYMONTH, and for daily rules, BYMONTHDAY and BYDAY.
+func (r *rrule) matches(t time.Time) bool {
+	if len(r.byMonth) > 0 && !containsMonth(r.byMonth, t.Month()) {
+		return false
+	}
+	if r.freq != "DAILY" {
+		return true
+	}
+	if !r.matchesMonthDay(t) {
+		return false
+	}
+	if len(r.byDay) > 0 {
+		ok := false
+		for _, wn := range r.byDay {
+			ok = ok || wn.day == t.Weekday()
+		}
+		return ok
+	}
+	return true
+}
+
+func containsMonth(ms []time.Month, m time.Month) bool {
+	for _, x := range ms {
+		if x == m {
+			return true
+		}
+	}
+	return false
+}
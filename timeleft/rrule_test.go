@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestRRuleNext(t *testing.T) {
+	tests := []struct {
+		rule       string
+		start, now string
+		want       string
+	}{
+		{"FREQ=DAILY", "2026-10-01 09:00", "2026-10-19 10:00", "2026-10-20 09:00"},
+		{"FREQ=DAILY;INTERVAL=3", "2026-10-01 09:00", "2026-10-19 10:00", "2026-10-22 09:00"},
+		{"FREQ=DAILY;BYDAY=MO,WE", "2026-10-01 09:00", "2026-10-19 10:00", "2026-10-21 09:00"},
+		{"FREQ=DAILY;BYMONTHDAY=-1", "2026-10-01 09:00", "2026-10-19 10:00", "2026-10-31 09:00"},
+		{"FREQ=WEEKLY", "2026-10-02 17:00", "2026-10-19 10:00", "2026-10-23 17:00"},
+		{"FREQ=WEEKLY;BYDAY=MO,TH", "2026-10-01 17:00", "2026-10-19 18:00", "2026-10-22 17:00"},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=TU", "2026-10-06 17:00", "2026-10-14 10:00", "2026-10-20 17:00"},
+		{"FREQ=MONTHLY", "2026-01-31 12:00", "2026-02-01 00:00", "2026-03-31 12:00"},
+		{"FREQ=MONTHLY;BYDAY=-1FR", "2026-01-30 17:00", "2026-10-19 10:00", "2026-10-30 17:00"},
+		{"FREQ=MONTHLY;BYDAY=2TU", "2026-01-13 17:00", "2026-10-19 10:00", "2026-11-10 17:00"},
+		{"FREQ=MONTHLY;BYMONTHDAY=1,-1", "2026-01-01 00:00", "2026-10-19 10:00", "2026-10-31 00:00"},
+		{"FREQ=MONTHLY;BYDAY=FR;BYMONTHDAY=13", "2026-01-01 00:00", "2026-10-19 10:00", "2026-11-13 00:00"},
+		{"FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYMONTHDAY=-1", "2026-01-01 18:00", "2026-10-19 10:00", "2026-11-30 18:00"},
+		{"FREQ=YEARLY", "2024-02-29 00:00", "2024-03-01 00:00", "2028-02-29 00:00"},
+		{"FREQ=YEARLY;BYMONTH=3,9;BYDAY=1SU", "2026-01-01 02:00", "2026-10-19 10:00", "2027-03-07 02:00"},
+		{"FREQ=YEARLY;BYDAY=MO", "2026-01-05 09:00", "2026-10-19 10:00", "2026-10-26 09:00"},
+		{"FREQ=YEARLY;BYDAY=20MO", "2026-01-01 09:00", "2026-10-19 10:00", "2027-05-17 09:00"},
+		{"FREQ=YEARLY;BYDAY=-1SU", "2026-01-01 09:00", "2026-10-19 10:00", "2026-12-27 09:00"},
+		{"FREQ=YEARLY;BYMONTHDAY=13;BYDAY=FR", "2026-01-01 00:00", "2026-10-19 10:00", "2026-11-13 00:00"},
+		{"FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29", "2025-01-01 00:00", "2026-10-19 10:00", "2028-02-29 00:00"},
+		{"FREQ=DAILY;COUNT=3", "2026-10-01 09:00", "2026-10-19 10:00", "2026-10-03 09:00"},
+		{"FREQ=WEEKLY;UNTIL=20261015T000000Z", "2026-10-01 09:00", "2026-10-19 10:00", "2026-10-08 09:00"},
+		{"FREQ=MONTHLY;BYMONTHDAY=31;BYDAY=FR;BYMONTH=2", "2026-01-01 00:00", "2026-10-19 10:00", ""},
+	}
+	for _, test := range tests {
+		r, err := parseRRule(test.rule)
+		if err != nil {
+			t.Errorf("parseRRule(%q): %v", test.rule, err)
+			continue
+		}
+		var want time.Time
+		if test.want != "" {
+			want = date(test.want)
+		}
+		if got := r.next(date(test.start), date(test.now)); !got.Equal(want) {
+			t.Errorf("%s from %s: next after %s = %v, want %v", test.rule, test.start, test.now, got, want)
+		}
+	}
+}
+
+func TestRRuleExdates(t *testing.T) {
+	r, err := parseRRule("FREQ=DAILY;COUNT=4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.exdates = []time.Time{date("2026-10-02 09:00"), date("2026-10-04 09:00")}
+	start := date("2026-10-01 09:00")
+	tests := []struct{ now, want string }{
+		{"2026-10-01 10:00", "2026-10-03 09:00"},
+		// The last occurrence is excluded, and it still counts.
+		{"2026-10-03 10:00", "2026-10-03 09:00"},
+	}
+	for _, test := range tests {
+		if got := r.next(start, date(test.now)); !got.Equal(date(test.want)) {
+			t.Errorf("next after %s = %v, want %v", test.now, got, test.want)
+		}
+	}
+}
+
+func TestParseRRuleErrors(t *testing.T) {
+	for _, rule := range []string{
+		"BYDAY=MO",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=MONTHLY;BYDAY=0MO",
+		"FREQ=MONTHLY;BYSETPOS=1",
+	} {
+		if _, err := parseRRule(rule); err == nil {
+			t.Errorf("parseRRule(%q) succeeded, want error", rule)
+		}
+	}
+}
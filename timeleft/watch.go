@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// A threshold is a time before a deadline at which to notify.
+type threshold struct {
+	before time.Duration
+	name   string // as given, like 1d
+}
+
+// parseThresholds parses a comma-separated list of durations in the
+// units of relative dates, like 1d,1h,10m.
+func parseThresholds(s string) ([]threshold, error) {
+	var ths []threshold
+	epoch := time.Unix(0, 0).UTC()
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		t, err := parseRelative("+"+f, epoch)
+		if err != nil {
+			return nil, fmt.Errorf("bad notification time %q", f)
+		}
+		ths = append(ths, threshold{t.Sub(epoch), f})
+	}
+	return ths, nil
+}
+
+// watch prints the time left until the deadlines returned by events,
+// rewriting the lines in place, until none are still to come. It
+// updates every second in the last hour before a deadline and every
+// minute otherwise. Unless inPlace is set, updates are printed after
+// the previous ones instead of replacing them. When a deadline comes
+// within a threshold, it runs command, or rings the bell if command is
+// empty.
+func watch(w io.Writer, events func(now time.Time) []deadline, ths []threshold, command string, inPlace bool) {
+	var (
+		prev   time.Time // of the last update
+		nlines int       // printed by the last update
+	)
+	for {
+		now := time.Now()
+		ds := events(now)
+		if inPlace && nlines > 0 {
+			// Move to the start of the first line and clear the rest.
+			fmt.Fprintf(w, "\r\033[%dA\033[J", nlines)
+		}
+		for _, d := range ds {
+			fmt.Fprintln(w, describe(d.Name, d.Date, now))
+		}
+		nlines = len(ds)
+
+		if !prev.IsZero() {
+			for _, d := range ds {
+				for _, th := range ths {
+					at := d.Date.Add(-th.before)
+					if prev.Before(at) && !now.Before(at) {
+						notify(w, d, th, command)
+					}
+				}
+			}
+		}
+		prev = now
+
+		next, ok := nextUpdate(ds, ths, now)
+		if !ok {
+			return
+		}
+		time.Sleep(next.Sub(now))
+	}
+}
+
+// nextUpdate returns when the countdown next changes or a threshold is
+// reached, or false if every deadline has passed.
+func nextUpdate(ds []deadline, ths []threshold, now time.Time) (time.Time, bool) {
+	var next time.Time
+	earlier := func(t time.Time) {
+		if t.After(now) && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	for _, d := range ds {
+		left := d.Date.Sub(now)
+		if left <= 0 {
+			continue
+		}
+		if left <= time.Hour {
+			earlier(now.Truncate(time.Second).Add(time.Second))
+		} else {
+			// The minutes shown change when the time left
+			// crosses a whole minute.
+			step := time.Minute
+			if out.smallest < step {
+				step = out.smallest
+			}
+			r := left % step
+			if r == 0 {
+				r = step
+			}
+			earlier(now.Add(r))
+		}
+		earlier(d.Date)
+		for _, th := range ths {
+			earlier(d.Date.Add(-th.before))
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// notify runs command in the background, or rings the bell.
+// The command gets the deadline in its environment.
+func notify(w io.Writer, d deadline, th threshold, command string) {
+	if command == "" {
+		fmt.Fprint(w, "\a")
+		return
+	}
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		"TIMELEFT_EVENT="+d.Name,
+		"TIMELEFT_DATE="+d.Date.Format(time.RFC3339),
+		"TIMELEFT_BEFORE="+th.name)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		log.Print(err)
+		return
+	}
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			log.Printf("%s: %v", command, err)
+		}
+	}()
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A workCal says when work happens: during working hours on days that
+// are neither weekend days nor holidays.
+type workCal struct {
+	weekend    [7]bool
+	holidays   map[string]bool // dates like 2006-01-02
+	start, end time.Duration   // working hours, as offsets from midnight
+}
+
+func defaultHolidaysFile() string {
+	return filepath.Join(xdgConfigDir(), "timeleft", "holidays")
+}
+
+// newWorkCal returns a calendar with weekend days like "sat,sun",
+// hours like "9-18" or "9:30-17:30", or "" for all day, and the
+// holidays in the file at holidaysPath.
+func newWorkCal(weekend, hours, holidaysPath string) (*workCal, error) {
+	c := &workCal{start: 0, end: 24 * time.Hour}
+	for _, f := range strings.Split(weekend, ",") {
+		if f = strings.TrimSpace(strings.ToLower(f)); f == "" {
+			continue
+		}
+		d := parseWeekday(f)
+		if d < 0 {
+			return nil, fmt.Errorf("bad weekend day %q", f)
+		}
+		c.weekend[d] = true
+	}
+	if hours != "" {
+		i := strings.IndexByte(hours, '-')
+		if i < 0 {
+			return nil, fmt.Errorf("bad working hours %q", hours)
+		}
+		var err error
+		if c.start, err = parseHour(hours[:i]); err == nil {
+			c.end, err = parseHour(hours[i+1:])
+		}
+		if err != nil || c.start >= c.end {
+			return nil, fmt.Errorf("bad working hours %q", hours)
+		}
+	}
+	var err error
+	c.holidays, err = readHolidays(holidaysPath, holidaysPath == defaultHolidaysFile())
+	return c, err
+}
+
+// parseHour parses an hour like 9 or 17:30 into an offset from midnight.
+func parseHour(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, ":") {
+		s += ":00"
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		if s == "24:00" {
+			return 24 * time.Hour, nil
+		}
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// readHolidays reads a file of dates like 2006-01-02, one per line.
+// Blank lines and text after # are ignored, so each date can be named.
+// A missing file is not an error if optional is set.
+func readHolidays(p string, optional bool) (map[string]bool, error) {
+	holidays := make(map[string]bool)
+	if p == "" {
+		return holidays, nil
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if optional && os.IsNotExist(err) {
+			return holidays, nil
+		}
+		return nil, err
+	}
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for lineno := 1; s.Scan(); lineno++ {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fs := strings.Fields(line)
+		if len(fs) == 0 {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", fs[0]); err != nil {
+			return nil, fmt.Errorf("%s:%d: bad date %q", p, lineno, fs[0])
+		}
+		holidays[fs[0]] = true
+	}
+	return holidays, nil
+}
+
+// dayLen returns the length of a working day.
+func (c *workCal) dayLen() time.Duration { return c.end - c.start }
+
+// workTime returns the working time between from and to.
+// Days are counted in the location of from.
+func (c *workCal) workTime(from, to time.Time) time.Duration {
+	to = to.In(from.Location())
+	var total time.Duration
+	y, m, d := from.Date()
+	for day := time.Date(y, m, d, 0, 0, 0, 0, from.Location()); day.Before(to); day = day.AddDate(0, 0, 1) {
+		if c.weekend[day.Weekday()] || c.holidays[day.Format("2006-01-02")] {
+			continue
+		}
+		// Add the offsets to the date, not the instant, so that
+		// working hours keep to the clock across DST changes.
+		start := clockTime(day, c.start)
+		end := clockTime(day, c.end)
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if end.After(start) {
+			total += end.Sub(start)
+		}
+	}
+	return total
+}
+
+func clockTime(day time.Time, off time.Duration) time.Time {
+	if off == 24*time.Hour {
+		return day.AddDate(0, 0, 1)
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), int(off/time.Hour), int(off%time.Hour/time.Minute), 0, 0, day.Location())
+}
+
+// units returns the units that working time is given in.
+func (c *workCal) units() []durUnit {
+	return append([]durUnit{{"work days", c.dayLen()}}, calUnits[2:]...)
+}